@@ -0,0 +1,64 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdint.h>
+// #include <stdlib.h>
+//
+// extern int goAuthorize(sasl_conn_t *conn, uintptr_t handle,
+//       char *requested_user, unsigned rlen, char *auth_identity,
+//       unsigned alen);
+//
+// int cb_proxy_policy(sasl_conn_t *conn, void *context,
+//       const char *requested_user, unsigned rlen, const char *auth_identity,
+//       unsigned alen, const char *def_realm, unsigned urlen,
+//       struct propctx *propctx) {
+//     return goAuthorize(conn, (uintptr_t)context, (char *)requested_user,
+//           rlen, (char *)auth_identity, alen);
+// }
+//
+// void set_error(sasl_conn_t *conn, char *message) {
+//     sasl_seterror(conn, 0, "%s", message);
+// }
+import "C"
+import (
+	"context"
+	"errors"
+	"unsafe"
+)
+
+// AuthorizeFunc decides whether the user authenticated as authnID may act
+// as authzID. It is only called when the two differ. An *Error selects the
+// result code returned to the client, any other error is SASL_NOAUTHZ. ctx is
+// the context passed to StartContext or StepContext, or
+// context.Background().
+type AuthorizeFunc func(ctx context.Context, authnID, authzID string) error
+
+// authorize runs fn for libsasl2 and reports the error on conn.
+func authorize(conn *C.sasl_conn_t, fn AuthorizeFunc, authnID,
+	authzID string) C.int {
+	if authzID == "" || authzID == authnID {
+		return C.SASL_OK
+	}
+
+	err := fn(connContext(conn), authnID, authzID)
+	if err == nil {
+		return C.SASL_OK
+	}
+	return reportError(conn, err, C.SASL_NOAUTHZ)
+}
+
+// reportError sets err as the error message of conn for a callback or
+// plugin implemented in Go. It returns the code of an *Error, or fallback.
+func reportError(conn *C.sasl_conn_t, err error, fallback C.int) C.int {
+	message := C.CString(err.Error())
+	defer C.free(unsafe.Pointer(message))
+	C.set_error(conn, message)
+
+	var saslErr *Error
+	if errors.As(err, &saslErr) {
+		return C.int(saslErr.Code)
+	}
+	return fallback
+}
@@ -0,0 +1,109 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/prop.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// void free_options(char **opts);
+//
+// char **new_propnames(unsigned n) {
+//     char **names = (char **)malloc(sizeof(char *)*(n+1));
+//     memset(names, 0, sizeof(char *)*(n+1));
+//     return names;
+// }
+//
+// void set_propname(char **names, unsigned i, char *name) {
+//     names[i] = name;
+// }
+//
+// const struct propval *propval_at(const struct propval *vals, unsigned i) {
+//     return vals + i;
+// }
+//
+// const char *propval_value(const struct propval *val, unsigned i) {
+//     return val->values[i];
+// }
+import "C"
+
+// RequestProps asks the auxiliary property plugins, such as sasldb, ldapdb
+// or sql, to look up names for the user once authenticated. Names starting
+// with "*" are looked up for the authentication identity, the others for
+// the authorization identity. It is only valid in StateNew. See Props.
+func (ss *Server) RequestProps(names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	// libsasl2 keeps the names until the connection is disposed
+	namesStr := C.new_propnames(C.uint(len(names)))
+	for i, name := range names {
+		C.set_propname(namesStr, C.uint(i), C.CString(name))
+	}
+
+	conn, err := ss.lock("RequestProps", StateNew)
+	if err != nil {
+		C.free_options(namesStr)
+		return err
+	}
+	defer ss.mu.Unlock()
+
+	res := C.sasl_auxprop_request(conn, (**C.char)(namesStr))
+	if res != C.SASL_OK {
+		C.free_options(namesStr)
+		return newError(conn, res, "RequestProps")
+	}
+	ss.props = append(ss.props, namesStr)
+	ss.propNames = append(ss.propNames, names...)
+	return nil
+}
+
+// Props returns the values of the properties requested with RequestProps
+// that were found for the user. It is only valid in StateAuthenticated.
+func (ss *Server) Props() (map[string][]string, error) {
+	conn, err := ss.lock("Props", StateAuthenticated)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.mu.Unlock()
+
+	props := make(map[string][]string)
+	ctx := C.sasl_auxprop_getctx(conn)
+	if ctx == nil {
+		return props, nil
+	}
+
+	requested := make(map[string]bool, len(ss.propNames))
+	for _, name := range ss.propNames {
+		requested[name] = true
+	}
+
+	// only requested properties are returned, libsasl2 looks up others,
+	// such as password hashes, for its own use
+	vals := C.prop_get(ctx)
+	for i := C.uint(0); ; i++ {
+		val := C.propval_at(vals, i)
+		if val.name == nil {
+			break
+		}
+		name := C.GoString(val.name)
+		if !requested[name] || val.values == nil {
+			continue
+		}
+		for j := C.uint(0); j < val.nvalues; j++ {
+			props[name] = append(props[name],
+				C.GoString(C.propval_value(val, j)))
+		}
+	}
+	return props, nil
+}
+
+// freeProps frees the names passed to sasl_auxprop_request. The connection
+// must have been disposed.
+func freeProps(props []**C.char) {
+	for _, names := range props {
+		C.free_options(names)
+	}
+}
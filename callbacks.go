@@ -0,0 +1,168 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/saslplug.h>
+// #include <stdint.h>
+import "C"
+import (
+	"runtime/cgo"
+	"unsafe"
+)
+
+// freeHandle releases a handle passed as the context of a callback.
+func freeHandle(h cgo.Handle) {
+	if h != 0 {
+		h.Delete()
+	}
+}
+
+// goVerifyFile is called from libsasl2 through SASL_CB_VERIFYFILE.
+//
+//export goVerifyFile
+func goVerifyFile(file *C.char, typ C.int) C.int {
+	if verifyFile == nil {
+		return C.SASL_OK
+	}
+	if err := verifyFile(C.GoString(file), VerifyType(typ)); err != nil {
+		return C.SASL_CONTINUE
+	}
+	return C.SASL_OK
+}
+
+// goLog is called from libsasl2 through SASL_CB_LOG.
+//
+//export goLog
+func goLog(handle C.uintptr_t, level C.int, message *C.char) C.int {
+	sl := cgo.Handle(handle).Value().(*saslLogger)
+	sl.log(level, C.GoString(message))
+	return C.SASL_OK
+}
+
+// goMechanismInfo is called from sasl_client_plugin_info and
+// sasl_server_plugin_info for every mechanism.
+//
+//export goMechanismInfo
+func goMechanismInfo(handle C.uintptr_t, name, plugin *C.char, maxSSF,
+	securityFlags, features C.uint) {
+	infos := cgo.Handle(handle).Value().(*[]MechanismInfo)
+	*infos = append(*infos, MechanismInfo{
+		Name:          C.GoString(name),
+		Plugin:        C.GoString(plugin),
+		MaxSSF:        uint(maxSSF),
+		SecurityFlags: SecurityFlags(securityFlags),
+		Features:      Features(features),
+	})
+}
+
+// goAuthorize is called from libsasl2 through SASL_CB_PROXY_POLICY.
+//
+//export goAuthorize
+func goAuthorize(conn *C.sasl_conn_t, handle C.uintptr_t,
+	requestedUser *C.char, rlen C.unsigned, authIdentity *C.char,
+	alen C.unsigned) C.int {
+	fn := cgo.Handle(handle).Value().(AuthorizeFunc)
+	return authorize(conn, fn, C.GoStringN(authIdentity, C.int(alen)),
+		C.GoStringN(requestedUser, C.int(rlen)))
+}
+
+// goAuxpropLookup is called from the auxprop_lookup function of a plugin
+// added by RegisterUserStore.
+//
+//export goAuxpropLookup
+func goAuxpropLookup(name *C.char, sparams *C.sasl_server_params_t,
+	flags C.unsigned, user *C.char, ulen C.unsigned) C.int {
+	return auxpropLookup(C.GoString(name), sparams, flags,
+		C.GoStringN(user, C.int(ulen)))
+}
+
+// goAuxpropStore is called from the auxprop_store function of a plugin
+// added by RegisterUserStore.
+//
+//export goAuxpropStore
+func goAuxpropStore(name *C.char, sparams *C.sasl_server_params_t,
+	ctx *C.struct_propctx, user *C.char, ulen C.unsigned) C.int {
+	return auxpropStore(C.GoString(name), sparams, ctx,
+		C.GoStringN(user, C.int(ulen)))
+}
+
+// goClientMechNew is called from the mech_new function of a mechanism added
+// by RegisterClientMechanism.
+//
+//export goClientMechNew
+func goClientMechNew(name *C.char, cparams *C.sasl_client_params_t,
+	handle *C.uintptr_t) C.int {
+	h, res := clientMechNew(C.GoString(name), cparams)
+	*handle = C.uintptr_t(h)
+	return res
+}
+
+// goClientMechStep is called from the mech_step function of a mechanism
+// added by RegisterClientMechanism.
+//
+//export goClientMechStep
+func goClientMechStep(handle C.uintptr_t, cparams *C.sasl_client_params_t,
+	serverin *C.char, serverinlen C.unsigned, clientout **C.char,
+	clientoutlen *C.unsigned, oparams *C.sasl_out_params_t) C.int {
+	var challenge []byte
+	if serverin != nil {
+		challenge = C.GoBytes(unsafe.Pointer(serverin), C.int(serverinlen))
+	}
+	return clientMechStep(cgo.Handle(handle), cparams, challenge, clientout,
+		clientoutlen, oparams)
+}
+
+// goMechDispose is called from the mech_dispose function of a mechanism
+// added by RegisterClientMechanism or RegisterServerMechanism.
+//
+//export goMechDispose
+func goMechDispose(handle C.uintptr_t) {
+	mechDispose(cgo.Handle(handle))
+}
+
+// goServerMechNew is called from the mech_new function of a mechanism added
+// by RegisterServerMechanism.
+//
+//export goServerMechNew
+func goServerMechNew(name *C.char, sparams *C.sasl_server_params_t,
+	handle *C.uintptr_t) C.int {
+	h, res := serverMechNew(C.GoString(name), sparams)
+	*handle = C.uintptr_t(h)
+	return res
+}
+
+// goServerMechStep is called from the mech_step function of a mechanism
+// added by RegisterServerMechanism.
+//
+//export goServerMechStep
+func goServerMechStep(handle C.uintptr_t, sparams *C.sasl_server_params_t,
+	clientin *C.char, clientinlen C.unsigned, serverout **C.char,
+	serveroutlen *C.unsigned, oparams *C.sasl_out_params_t) C.int {
+	var response []byte
+	if clientin != nil {
+		response = C.GoBytes(unsafe.Pointer(clientin), C.int(clientinlen))
+	}
+	return serverMechStep(cgo.Handle(handle), sparams, response, serverout,
+		serveroutlen, oparams)
+}
+
+// goCanonUser is called from libsasl2 through SASL_CB_CANON_USER.
+//
+//export goCanonUser
+func goCanonUser(conn *C.sasl_conn_t, handle C.uintptr_t, in *C.char,
+	inlen C.unsigned, flags C.unsigned, userRealm *C.char, out *C.char,
+	outMax C.unsigned, outLen *C.unsigned) C.int {
+	fn := cgo.Handle(handle).Value().(CanonicalizeFunc)
+	return canonicalize(conn, fn, C.GoStringN(in, C.int(inlen)),
+		C.GoString(userRealm), CanonFlags(flags), out, outMax, outLen)
+}
+
+// goChooseRealm is called from libsasl2 through SASL_CB_GETREALM.
+//
+//export goChooseRealm
+func goChooseRealm(conn *C.sasl_conn_t, handle C.uintptr_t,
+	availrealms **C.char, result **C.char) C.int {
+	rc := cgo.Handle(handle).Value().(*realmChooser)
+	return rc.choose(conn, goStrings(availrealms), result)
+}
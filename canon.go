@@ -0,0 +1,78 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdint.h>
+//
+// extern int goCanonUser(sasl_conn_t *conn, uintptr_t handle, char *in,
+//       unsigned inlen, unsigned flags, char *user_realm, char *out,
+//       unsigned out_max, unsigned *out_len);
+//
+// int cb_canon_user(sasl_conn_t *conn, void *context, const char *in,
+//       unsigned inlen, unsigned flags, const char *user_realm, char *out,
+//       unsigned out_max, unsigned *out_len) {
+//     return goCanonUser(conn, (uintptr_t)context, (char *)in, inlen, flags,
+//           (char *)user_realm, out, out_max, out_len);
+// }
+import "C"
+import (
+	"context"
+	"fmt"
+	"unsafe"
+)
+
+// CanonFlags tell which identity is canonicalized.
+type CanonFlags uint
+
+// Flags passed to a CanonicalizeFunc.
+const (
+	// CanonAuthID is set for the authentication identity.
+	CanonAuthID CanonFlags = C.SASL_CU_AUTHID
+	// CanonAuthzID is set for the authorization identity. Both flags are
+	// set when the identities are the same.
+	CanonAuthzID CanonFlags = C.SASL_CU_AUTHZID
+	// CanonExternallyVerified is set when the identity was verified
+	// outside of SASL, e.g. by EXTERNAL.
+	CanonExternallyVerified CanonFlags = C.SASL_CU_EXTERNALLY_VERIFIED
+	// CanonOverride is set when the identity should replace the one
+	// canonicalized before.
+	CanonOverride CanonFlags = C.SASL_CU_OVERRIDE
+)
+
+// Has reports whether all of flags are set in f.
+func (f CanonFlags) Has(flags CanonFlags) bool {
+	return f&flags == flags
+}
+
+// CanonicalizeFunc maps user, as sent by the peer or the mechanism, to the
+// name used by the application, e.g. by lowercasing it or stripping a
+// Kerberos realm. realm is the user realm of a server, empty for clients.
+// An *Error selects the result code of the failed handshake, any other error
+// is SASL_BADPROT (SASL_CB_CANON_USER). ctx is the context passed to
+// StartContext or StepContext, or context.Background().
+type CanonicalizeFunc func(ctx context.Context, user, realm string,
+	flags CanonFlags) (string, error)
+
+// canonicalize runs fn for libsasl2 and writes its result to the out_max
+// bytes of out.
+func canonicalize(conn *C.sasl_conn_t, fn CanonicalizeFunc, user,
+	realm string, flags CanonFlags, out *C.char, outMax C.uint,
+	outLen *C.uint) C.int {
+	canon, err := fn(connContext(conn), user, realm, flags)
+	if err != nil {
+		return reportError(conn, err, C.SASL_BADPROT)
+	}
+
+	// out has room for the terminating NUL
+	if len(canon) >= int(outMax) {
+		err := fmt.Errorf("canonical name of %q is longer than %d bytes",
+			user, outMax-1)
+		return reportError(conn, err, C.SASL_BUFOVER)
+	}
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(out)), int(outMax))
+	n := copy(buf, canon)
+	buf[n] = 0
+	*outLen = C.uint(n)
+	return C.SASL_OK
+}
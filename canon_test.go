@@ -0,0 +1,101 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// TestClientCanonicalize lowercases the identities of a PLAIN client.
+func TestClientCanonicalize(t *testing.T) {
+	var flags CanonFlags
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "Alice",
+		Password: "pass",
+		Canonicalize: func(ctx context.Context, user, realm string,
+			f CanonFlags) (string, error) {
+			if ctx.Value(testContextKey{}) != "canon" {
+				t.Errorf("the callback did not get the context of Start")
+			}
+			flags |= f
+			return strings.ToLower(user), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	ctx := context.WithValue(context.Background(), testContextKey{}, "canon")
+	if _, _, _, err := cl.StartContext(ctx, []string{"PLAIN"}); err != nil {
+		t.Fatalf("could not start PLAIN: %v", err)
+	}
+	r, err := cl.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.AuthnID != "alice" || r.AuthzID != "alice" {
+		t.Errorf("expected identities alice and alice, got %q and %q",
+			r.AuthnID, r.AuthzID)
+	}
+	if !flags.Has(CanonAuthID | CanonAuthzID) {
+		t.Errorf("expected both identities to be canonicalized, got %v",
+			flags)
+	}
+}
+
+// stripRealm maps Kerberos principals of EXAMPLE.COM to local users.
+func stripRealm(ctx context.Context, user, realm string,
+	flags CanonFlags) (string, error) {
+	user, _ = strings.CutSuffix(user, "@EXAMPLE.COM")
+	switch user {
+	case "MALLORY":
+		return "", errors.New("mallory is not welcome")
+	case "LONG":
+		return strings.Repeat("long", 1024), nil
+	}
+	return strings.ToLower(user), nil
+}
+
+// TestServerCanonicalize maps the identities sent to a server.
+func TestServerCanonicalize(t *testing.T) {
+	tests := []struct {
+		user string
+		err  error
+	}{
+		{"ALICE@EXAMPLE.COM", nil},
+		{"MALLORY@EXAMPLE.COM", ErrBadProt},
+		{"LONG", ErrBufOver},
+	}
+	for _, test := range tests {
+		t.Run(test.user, func(t *testing.T) {
+			ss := NewMechServer(t, &ServerConfig{Canonicalize: stripRealm})
+			defer ss.Free()
+			cl, err := NewClient("service", "hostname", &Config{
+				Username: test.user,
+				Password: "secret",
+			})
+			if err != nil {
+				t.Fatalf("could not create client: %v", err)
+			}
+			defer cl.Free()
+
+			err = mechHandshake(cl, ss)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if test.err != nil {
+				return
+			}
+			r, err := ss.Result()
+			if err != nil {
+				t.Fatalf("could not get the result: %v", err)
+			}
+			if r.AuthnID != "alice" || r.AuthzID != "alice" {
+				t.Errorf("expected identities alice and alice, got %q and %q",
+					r.AuthnID, r.AuthzID)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// sasl_channel_binding_t *new_channel_binding(char *name, int critical,
+//       unsigned char *data, unsigned long len) {
+//     sasl_channel_binding_t *cb = (sasl_channel_binding_t *)malloc(
+//           sizeof(sasl_channel_binding_t));
+//
+//     cb->name     = name;
+//     cb->critical = critical;
+//     cb->data     = data;
+//     cb->len      = len;
+//     return cb;
+// }
+//
+// void free_channel_binding(sasl_channel_binding_t *cb) {
+//     if( !cb )
+//         return;
+//
+//     free((char *)cb->name);
+//     free((unsigned char *)cb->data);
+//     free(cb);
+// }
+import "C"
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Channel binding types defined by RFC 5929 and RFC 9266.
+const (
+	TLSUnique         = "tls-unique"
+	TLSServerEndPoint = "tls-server-end-point"
+	TLSExporter       = "tls-exporter"
+)
+
+// ChannelBinding binds a SASL exchange to the TLS connection it runs over
+// (SASL_CHANNEL_BINDING), so that mechanisms such as SCRAM-SHA-256-PLUS can
+// detect a man in the middle.
+type ChannelBinding struct {
+	// Name is the channel binding type, e.g. TLSExporter.
+	Name string
+
+	// Data is the channel binding data of the TLS connection.
+	Data []byte
+
+	// Required refuses every mechanism that does not support channel
+	// binding, i.e. every mechanism whose name does not end with "-PLUS".
+	// A client offered none of the others fails to start with ErrNoMech.
+	Required bool
+}
+
+// NewChannelBinding computes the channel binding of type typ from a
+// completed TLS handshake. For TLSServerEndPoint, the server certificate is
+// taken from the peer certificates, so servers must use
+// NewServerEndPointBinding instead.
+func NewChannelBinding(typ string, state *tls.ConnectionState,
+	required bool) (*ChannelBinding, error) {
+	var data []byte
+
+	if state == nil || !state.HandshakeComplete {
+		return nil, errors.New("sasl: TLS handshake has not been completed")
+	}
+
+	switch typ {
+	case TLSUnique:
+		if len(state.TLSUnique) == 0 {
+			return nil, fmt.Errorf("sasl: %v is not available with this TLS "+
+				"version", typ)
+		}
+		data = state.TLSUnique
+	case TLSServerEndPoint:
+		if len(state.PeerCertificates) == 0 {
+			return nil, &Error{Op: "NewChannelBinding", Code: C.SASL_BADPARAM,
+				Detail: typ + " needs the server certificate"}
+		}
+		return NewServerEndPointBinding(state.PeerCertificates[0], required)
+	case TLSExporter:
+		var err error
+		data, err = state.ExportKeyingMaterial("EXPORTER-Channel-Binding", nil,
+			32)
+		if err != nil {
+			return nil, fmt.Errorf("sasl: %v: %v", typ, err)
+		}
+	default:
+		return nil, fmt.Errorf("sasl: unknown channel binding type %q", typ)
+	}
+
+	return &ChannelBinding{Name: typ, Data: data, Required: required}, nil
+}
+
+// NewServerEndPointBinding computes the tls-server-end-point channel binding
+// of the server certificate cert, as defined by RFC 5929. It fails with
+// ErrBadParam if cert is nil.
+func NewServerEndPointBinding(cert *x509.Certificate,
+	required bool) (*ChannelBinding, error) {
+	var hash crypto.Hash
+
+	if cert == nil {
+		return nil, &Error{Op: "NewServerEndPointBinding",
+			Code: C.SASL_BADPARAM, Detail: "no server certificate"}
+	}
+
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		hash = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		hash = crypto.SHA512
+	case x509.PureEd25519, x509.UnknownSignatureAlgorithm:
+		return nil, fmt.Errorf("sasl: %v is undefined for %v certificates",
+			TLSServerEndPoint, cert.SignatureAlgorithm)
+	default:
+		// MD5, SHA-1 and SHA-256 signatures all use SHA-256.
+		hash = crypto.SHA256
+	}
+
+	h := hash.New()
+	h.Write(cert.Raw)
+	return &ChannelBinding{
+		Name:     TLSServerEndPoint,
+		Data:     h.Sum(nil),
+		Required: required,
+	}, nil
+}
+
+// newChannelBinding copies cb into a sasl_channel_binding_t. libsasl2 keeps a
+// pointer to it, so it must be freed only after the connection is disposed.
+func newChannelBinding(cb *ChannelBinding) *C.sasl_channel_binding_t {
+	if cb == nil {
+		return nil
+	}
+
+	critical := C.int(0)
+	if cb.Required {
+		critical = 1
+	}
+	return C.new_channel_binding(C.CString(cb.Name), critical,
+		(*C.uchar)(C.CBytes(cb.Data)), C.ulong(len(cb.Data)))
+}
+
+// setChannelBinding sets the SASL_CHANNEL_BINDING property on conn.
+func setChannelBinding(conn *C.struct_sasl_conn,
+	cb *C.sasl_channel_binding_t) error {
+	res := C.sasl_setprop(conn, C.SASL_CHANNEL_BINDING, unsafe.Pointer(cb))
+	if res != C.SASL_OK {
+		return newError(conn, res, "setChannelBinding")
+	}
+	return nil
+}
+
+// bindingMechs returns the mechanisms of mechlist that cb allows: all of them,
+// or only those that support channel binding if cb is required.
+func bindingMechs(cb *ChannelBinding, mechlist []string) []string {
+	if cb == nil || !cb.Required {
+		return mechlist
+	}
+
+	var mechs []string
+	for _, mech := range mechlist {
+		if strings.HasSuffix(mech, "-PLUS") {
+			mechs = append(mechs, mech)
+		}
+	}
+	return mechs
+}
+
+// checkChannelBinding returns an error if cb is required and mech does not
+// support channel binding.
+func checkChannelBinding(cb *ChannelBinding, mech, op string) error {
+	if cb == nil || !cb.Required || strings.HasSuffix(mech, "-PLUS") {
+		return nil
+	}
+	detail := fmt.Sprintf("channel binding is required, but %v does not "+
+		"support it", mech)
+	return &Error{Op: op, Code: C.SASL_BADBINDING, Detail: detail}
+}
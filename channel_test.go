@@ -0,0 +1,190 @@
+package sasl
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// NewTestCertificate creates a self-signed certificate for localhost.
+func NewTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("could not parse certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key,
+		Leaf: leaf}
+}
+
+// TLSLoopback performs a TLS handshake over an in-process pipe and returns
+// the client and server connection states.
+func TLSLoopback(t *testing.T, serverConf, clientConf *tls.Config) (
+	client, server tls.ConnectionState) {
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	tlsClient := tls.Client(clientConn, clientConf)
+	tlsServer := tls.Server(serverConn, serverConf)
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- tlsServer.Handshake()
+	}()
+	if err := tlsClient.Handshake(); err != nil {
+		t.Fatalf("client handshake failed: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake failed: %v", err)
+	}
+
+	return tlsClient.ConnectionState(), tlsServer.ConnectionState()
+}
+
+// TestChannelBindingTypes checks that both ends of a TLS connection compute
+// the same channel binding data.
+func TestChannelBindingTypes(t *testing.T) {
+	cert := NewTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	tests := []struct {
+		typ     string
+		version uint16
+	}{
+		{TLSUnique, tls.VersionTLS12},
+		{TLSExporter, tls.VersionTLS13},
+		{TLSServerEndPoint, tls.VersionTLS13},
+	}
+
+	for _, test := range tests {
+		serverConf := &tls.Config{Certificates: []tls.Certificate{cert},
+			MaxVersion: test.version}
+		clientConf := &tls.Config{RootCAs: pool, ServerName: "localhost",
+			MaxVersion: test.version}
+		clientState, serverState := TLSLoopback(t, serverConf, clientConf)
+
+		clientCB, err := NewChannelBinding(test.typ, &clientState, true)
+		if err != nil {
+			t.Fatalf("%v: client binding: %v", test.typ, err)
+		}
+
+		var serverCB *ChannelBinding
+		if test.typ == TLSServerEndPoint {
+			serverCB, err = NewServerEndPointBinding(cert.Leaf, true)
+		} else {
+			serverCB, err = NewChannelBinding(test.typ, &serverState, true)
+		}
+		if err != nil {
+			t.Fatalf("%v: server binding: %v", test.typ, err)
+		}
+
+		if len(clientCB.Data) == 0 || !bytes.Equal(clientCB.Data, serverCB.Data) {
+			t.Errorf("%v: bindings differ: %x != %x", test.typ, clientCB.Data,
+				serverCB.Data)
+		}
+	}
+
+	// tls-unique is undefined for TLS 1.3
+	clientState, _ := TLSLoopback(t,
+		&tls.Config{Certificates: []tls.Certificate{cert}},
+		&tls.Config{RootCAs: pool, ServerName: "localhost"})
+	if _, err := NewChannelBinding(TLSUnique, &clientState, false); err == nil {
+		t.Errorf("expected an error for tls-unique over TLS 1.3")
+	}
+}
+
+// TestServerEndPointNoCertificate computes tls-server-end-point without a
+// server certificate.
+func TestServerEndPointNoCertificate(t *testing.T) {
+	if _, err := NewServerEndPointBinding(nil, false); !errors.Is(err,
+		ErrBadParam) {
+		t.Errorf("expected ErrBadParam, got %v", err)
+	}
+
+	// the server end of a TLS connection has no peer certificates
+	cert := NewTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	_, serverState := TLSLoopback(t,
+		&tls.Config{Certificates: []tls.Certificate{cert}},
+		&tls.Config{RootCAs: pool, ServerName: "localhost"})
+	_, err := NewChannelBinding(TLSServerEndPoint, &serverState, false)
+	if !errors.Is(err, ErrBadParam) {
+		t.Errorf("expected ErrBadParam, got %v", err)
+	}
+}
+
+// TestChannelBindingRequired checks that a required channel binding refuses
+// mechanisms without channel binding support.
+func TestChannelBindingRequired(t *testing.T) {
+	cb := &ChannelBinding{Name: TLSExporter, Data: make([]byte, 32),
+		Required: true}
+
+	cl, err := NewClient("service", "hostname", &Config{
+		Username:       "user",
+		Password:       "pass",
+		ChannelBinding: cb,
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	_, _, _, err = cl.Start([]string{"PLAIN"})
+	if !errors.Is(err, ErrNoMech) {
+		t.Errorf("expected ErrNoMech, got %v", err)
+	}
+	if state := cl.State(); state != StateFailed {
+		t.Errorf("expected state failed, got %v", state)
+	}
+
+	ss := NewTestServer(t, &ServerConfig{ChannelBinding: cb})
+	defer ss.Free()
+
+	if _, _, err := ss.Start("PLAIN", nil); !errors.Is(err, ErrBadBinding) {
+		t.Errorf("expected ErrBadBinding, got %v", err)
+	}
+	if state := ss.State(); state != StateFailed {
+		t.Errorf("expected state failed, got %v", state)
+	}
+
+	// a freed server reports its state before refusing the mechanism
+	ss = NewTestServer(t, &ServerConfig{ChannelBinding: cb})
+	ss.Free()
+
+	_, _, err = ss.Start("PLAIN", nil)
+	stateError(t, err, "Start", StateFreed)
+	if !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
@@ -1,17 +1,9 @@
-// sasl is a wrapper for the cyrus sasl library written for go.
-// Right now it only supports clients, but that could change in the future.
-// It is meant as a simple interface for interacting with a multitude of
-// authentication mechanisms. Use it just as you would the C library --
-// initialize a Client, call the client's Start method, then keep calling
-// Step until the authentication has completed. After Client is done, call
-// its Free method to cleanup any extra memory resources. The library was
-// written such that multiple calls to Free is ok.
 package sasl
 
 // #cgo LDFLAGS: -lsasl2
 // #cgo CFLAGS: -Wall
 // #include <sasl/sasl.h>
-// #include <stdio.h>
+// #include <stdint.h>
 // #include <stdlib.h>
 // #include <string.h>
 //
@@ -21,19 +13,37 @@ package sasl
 //     sasl_callback_t *sc_cbs;
 //     char *sc_hostname;
 //     char *sc_service;
-//     char *sc_username;
-//     char *sc_authname;
+//     char *sc_username; // authorization identity
+//     char *sc_authname; // authentication identity
 //     char *sc_password;
-//     char *sc_realm;
+//     char *sc_chosen_realm;
+//     char **sc_prompted; // results of the prompts of the last Start or Step
+//     char **sc_options;
+//     uintptr_t sc_log_handle;
+//     uintptr_t sc_realm_handle;
+//     uintptr_t sc_canon_handle;
+//     sasl_channel_binding_t *sc_cbinding;
 // } SaslClient;
 //
 // void generate_callbacks(SaslClient *);
+// void free_client(SaslClient *);
+// void free_options(char **opts);
+// int cb_getopt(char **opts, const char *plugin_name, const char *option,
+//       const char **result, unsigned *len);
+// int cb_log(void *context, int level, const char *message);
+// int cb_canon_user(sasl_conn_t *conn, void *context, const char *in,
+//       unsigned inlen, unsigned flags, const char *user_realm, char *out,
+//       unsigned out_max, unsigned *out_len);
+// void free_channel_binding(sasl_channel_binding_t *cb);
+// extern int goChooseRealm(sasl_conn_t *conn, uintptr_t handle,
+//       char **availrealms, char **result);
 //
 // SaslClient* new_client(char *hostname, char *service, char *username,
-//       char *authname, char *password, char *realm,
-//       char *external_username, unsigned external_ssf, unsigned flags,
-//       unsigned min_ssf, unsigned max_ssf, unsigned maxbufsize) {
-//     int res;
+//       char *authname, char *password, uintptr_t realm_handle,
+//       char **options, uintptr_t log_handle, uintptr_t canon_handle,
+//       char *iplocalport, char *ipremoteport, char *external_username,
+//       unsigned external_ssf, unsigned flags, unsigned min_ssf,
+//       unsigned max_ssf, unsigned maxbufsize, int *res) {
 //     sasl_security_properties_t secprops;
 //     SaslClient *ret = (SaslClient *)malloc(sizeof(SaslClient));
 //     memset(ret, 0, sizeof(SaslClient));
@@ -43,23 +53,26 @@ package sasl
 //     ret->sc_username = username;
 //     ret->sc_authname = authname;
 //     ret->sc_password = password;
-//     ret->sc_realm    = realm;
+//     ret->sc_options  = options;
+//     ret->sc_log_handle = log_handle;
+//     ret->sc_realm_handle = realm_handle;
+//     ret->sc_canon_handle = canon_handle;
 //
 //     generate_callbacks(ret);
 //
-//     res = sasl_client_new(ret->sc_service, ret->sc_hostname, 0, 0,
-//             ret->sc_cbs, flags, &ret->sc_conn);
-//     if( res != SASL_OK )
+//     *res = sasl_client_new(ret->sc_service, ret->sc_hostname, iplocalport,
+//             ipremoteport, ret->sc_cbs, flags, &ret->sc_conn);
+//     if( *res != SASL_OK )
 //         goto cleanup;
 //
 //     if( external_username ){
-//	       res = sasl_setprop(ret->sc_conn, SASL_AUTH_EXTERNAL,
+//	       *res = sasl_setprop(ret->sc_conn, SASL_AUTH_EXTERNAL,
 //		           external_username);
-//         if( res != SASL_OK )
+//         if( *res != SASL_OK )
 //             goto cleanup;
 //
-//         res = sasl_setprop(ret->sc_conn, SASL_SSF_EXTERNAL, &external_ssf);
-//         if( res != SASL_OK )
+//         *res = sasl_setprop(ret->sc_conn, SASL_SSF_EXTERNAL, &external_ssf);
+//         if( *res != SASL_OK )
 //             goto cleanup;
 //     }
 //
@@ -68,12 +81,12 @@ package sasl
 //     secprops.max_ssf = max_ssf;
 //     secprops.maxbufsize = maxbufsize;
 //
-//     res = sasl_setprop(ret->sc_conn, SASL_SEC_PROPS, &secprops);
-//     if( res != SASL_OK )
+//     *res = sasl_setprop(ret->sc_conn, SASL_SEC_PROPS, &secprops);
+//     if( *res != SASL_OK )
 //         goto cleanup;
 //     return ret;
 // cleanup:
-//     free(ret);
+//     free_client(ret);
 //     return NULL;
 // }
 //
@@ -96,12 +109,15 @@ package sasl
 //         free(sc->sc_authname);
 //     if( sc->sc_password )
 //         free(sc->sc_password);
-//     if( sc->sc_realm )
-//         free(sc->sc_realm);
+//     if( sc->sc_chosen_realm )
+//         free(sc->sc_chosen_realm);
+//     free_options(sc->sc_prompted);
+//     free_options(sc->sc_options);
 //
 //     //dispose of the connection
 //     if( sc->sc_conn )
 //         sasl_dispose(&sc->sc_conn);
+//     free_channel_binding(sc->sc_cbinding);
 //
 //     free(sc);
 // }
@@ -136,18 +152,17 @@ package sasl
 //
 // int cb_getrealm(SaslClient *sc, int id, const char **availrealms,
 //   const char **result) {
-//     *result = (const char *)sc->sc_realm;
-//     return SASL_OK;
-// }
+//     char *realm = NULL;
+//     int res = goChooseRealm(sc->sc_conn, sc->sc_realm_handle,
+//           (char **)availrealms, &realm);
+//     if( res != SASL_OK )
+//         return res;
 //
-// int cb_canon_user(sasl_conn_t *conn, SaslClient *sc, const char *user,
-//       unsigned userLen, unsigned flags, const char *user_realm, char *out,
-//       unsigned out_max, unsigned *out_len) {
-//     if( user_realm )
-//	       *out_len = (unsigned)snprintf(out, out_max, "%s@%s", user,
-//                      user_realm);
-//     else
-//         *out_len = (unsigned)snprintf(out, out_max, "%s", user);
+//     // the realm is kept until the next call
+//     if( sc->sc_chosen_realm )
+//         free(sc->sc_chosen_realm);
+//     sc->sc_chosen_realm = realm;
+//     *result = realm;
 //     return SASL_OK;
 // }
 //
@@ -163,7 +178,7 @@ package sasl
 //           sizeof(sasl_callback_t)*10);
 //     int cbiter = 0;
 //
-//     if( sc->sc_realm ) {
+//     if( sc->sc_realm_handle ) {
 //         add_callback(cbs + cbiter++, (void *)sc, SASL_CB_GETREALM,
 //           (int (*)(void))cb_getrealm);
 //     } else {
@@ -171,8 +186,12 @@ package sasl
 //     }
 //         add_callback(cbs + cbiter++, (void *)sc, SASL_CB_USER,
 //           (int (*)(void))cb_name);
-//         add_callback(cbs + cbiter++, (void *)sc, SASL_CB_AUTHNAME,
-//           (int (*)(void))cb_name);
+//         if( sc->sc_authname ) {
+//             add_callback(cbs + cbiter++, (void *)sc, SASL_CB_AUTHNAME,
+//               (int (*)(void))cb_name);
+//         } else {
+//             add_callback(cbs + cbiter++, (void *)sc, SASL_CB_AUTHNAME, NULL);
+//         }
 //         if( sc->sc_password ) {
 //             add_callback(cbs + cbiter++, (void *)sc, SASL_CB_PASS,
 //               (int (*)(void))cb_password);
@@ -180,8 +199,15 @@ package sasl
 //             add_callback(cbs + cbiter++, (void *)sc, SASL_CB_PASS, NULL);
 //         }
 //
-//     add_callback(cbs + cbiter++, (void *)sc, SASL_CB_CANON_USER,
-//       (int (*)(void))cb_canon_user);
+//     if( sc->sc_canon_handle )
+//         add_callback(cbs + cbiter++, (void *)sc->sc_canon_handle,
+//           SASL_CB_CANON_USER, (int (*)(void))cb_canon_user);
+//     if( sc->sc_options )
+//         add_callback(cbs + cbiter++, (void *)sc->sc_options, SASL_CB_GETOPT,
+//           (int (*)(void))cb_getopt);
+//     if( sc->sc_log_handle )
+//         add_callback(cbs + cbiter++, (void *)sc->sc_log_handle, SASL_CB_LOG,
+//           (int (*)(void))cb_log);
 //     add_callback(cbs + cbiter++, (void *)sc, SASL_CB_LIST_END, NULL);
 //
 //     sc->sc_cbs = cbs;
@@ -191,23 +217,72 @@ import (
 	"C"
 )
 import (
-	"bufio"
-	"fmt"
+	"context"
 	"io"
-	"log"
-	"os"
+	"log/slog"
+	"net"
+	"runtime/cgo"
 	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
 // Config is a struct that holds the information needed to initialize a
 // SaslClient.
 type Config struct {
-	Username         string
-	Authname         string
+	// Username is the name of the user. It is the authentication identity
+	// unless Authname is set.
+	Username string
+
+	// Authname is the authentication identity: the user whose Password is
+	// checked. If empty, Username is used, and if both are empty the user
+	// is prompted. For compatibility, if Authname and Username differ and
+	// AuthzID is empty, Username is the authorization identity.
+	Authname string
+
+	// AuthzID is the authorization identity: the user the connection acts
+	// as once authenticated, e.g. the end user of a proxy. If empty, it is
+	// the authentication identity. If it differs, a mechanism that allows
+	// proxying is required (SASL_NEED_PROXY).
+	AuthzID string
+
 	Password         string
 	ExternalUsername string
-	Realm            string
+
+	// Realm is the realm of the user. Unless ChooseRealm is set, it is
+	// chosen when the server offers several realms only if it is one of
+	// them (see ConfiguredRealm). If both are empty, the user is prompted.
+	Realm string
+
+	// ChooseRealm, if set, chooses among the realms offered by the server.
+	ChooseRealm RealmFunc
+
+	// Options are served to libsasl2 and its plugins through SASL_CB_GETOPT
+	// and take precedence over the <appname>.conf file.
+	Options map[string]string
+
+	// Logger receives the messages logged by libsasl2 for this client. If
+	// nil, Options.Logger passed to Init is used. Password is redacted.
+	Logger *slog.Logger
+
+	// LocalAddr and RemoteAddr are the addresses of the connection to the
+	// server, e.g. conn.LocalAddr() and conn.RemoteAddr(). Some mechanisms,
+	// such as DIGEST-MD5, need them for their security layer.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// ChannelBinding binds the authentication to the TLS connection to the
+	// server. See NewChannelBinding.
+	ChannelBinding *ChannelBinding
+
+	// Prompt answers requests for information that is not in the Config. If
+	// nil, the user is asked on stdin.
+	Prompt PromptFunc
+
+	// Canonicalize, if set, maps the identities before they are used by
+	// the mechanism and reported by Result.
+	Canonicalize CanonicalizeFunc
 
 	MinSsf      uint32
 	MaxSsf      uint32
@@ -215,27 +290,53 @@ type Config struct {
 	ExternalSsf uint32
 }
 
-// Client is a structure that keeps the context of a sasl connection.
-type Client struct {
-	// libsaslwrapper
-	client        *C.struct_SaslClient_struct
-	maxBufsize    int
-	handshakeDone bool
+// identities returns the authentication and authorization identities
+// described by conf.
+func (conf *Config) identities() (authname, authzID string) {
+	authname, authzID = conf.Authname, conf.AuthzID
+	if authname == "" {
+		authname = conf.Username
+	} else if authzID == "" && conf.Username != "" &&
+		conf.Username != authname {
+		authzID = conf.Username
+	}
+	return authname, authzID
 }
 
-// init starts the underlying sasl libraries so that plugins can be in place
-// before we create any clients.
-func init() {
-	result := C.sasl_client_init(nil)
-	if result != C.SASL_OK {
-		log.Fatalf("could not start libsasl2: %v\n", C.sasl_errstring(result, nil, nil))
-	}
+// Client is a structure that keeps the context of a sasl connection. It is
+// safe to use from multiple goroutines: calls into libsasl2 are serialized,
+// and a wrapped stream may be read and written concurrently. The callbacks of
+// the Config run while Start or Step is in progress, so they may only call
+// the State and Free methods of the client; other methods wait for Start or
+// Step to return.
+type Client struct {
+	// mu guards the fields below and every use of the sasl connection but
+	// the calls of Start and Step, which run with busy set instead.
+	mu   sync.Mutex
+	busy chan struct{}
+
+	// libsaslwrapper
+	client         *C.struct_SaslClient_struct
+	logHandle      cgo.Handle
+	canonHandle    cgo.Handle
+	realmHandle    cgo.Handle
+	realms         *realmChooser
+	channelBinding *ChannelBinding
+	prompt         PromptFunc
+	maxBufsize     int
+	realm          string
+	externalSSF    uint32
+	state          State
+	completed      time.Time
 }
 
 // NewClient returns a new (initialized) client. If MaxSsf is not initialized,
 // then it defaults to 65535.  If MaxBufsize is 0, then it defaults to 65535.
 // If conf is nil, then use defaults.
 func NewClient(service, host string, conf *Config) (*Client, error) {
+	if err := initialize(); err != nil {
+		return nil, err
+	}
 
 	// fix defaults:
 	if conf == nil {
@@ -250,41 +351,70 @@ func NewClient(service, host string, conf *Config) (*Client, error) {
 
 	// create the client
 	cl := &Client{
-		handshakeDone: false,
-		maxBufsize:    int(conf.MaxBufsize),
+		maxBufsize:  int(conf.MaxBufsize),
+		prompt:      conf.Prompt,
+		realm:       conf.Realm,
+		externalSSF: conf.ExternalSsf,
 	}
 
 	// setup c client
 	hostStr := C.CString(host)
 	serviceStr := C.CString(service)
-	var usernameStr, authnameStr, passwordStr, realmStr,
-		externalUsernameStr *C.char
+	var authzIDStr, authnameStr, passwordStr, externalUsernameStr *C.char
 	flags := C.unsigned(0)
-	if len(conf.Username) > 0 {
-		usernameStr = C.CString(conf.Username)
+	authname, authzID := conf.identities()
+	if len(authzID) > 0 {
+		authzIDStr = C.CString(authzID)
 	}
-	if len(conf.Authname) > 0 {
-		authnameStr = C.CString(conf.Authname)
+	if len(authname) > 0 {
+		authnameStr = C.CString(authname)
+	}
+	if len(authzID) > 0 && authzID != authname {
+		flags |= C.SASL_NEED_PROXY
 	}
 	if len(conf.Password) > 0 {
 		passwordStr = C.CString(conf.Password)
 	}
-	if len(conf.Realm) > 0 {
-		realmStr = C.CString(conf.Realm)
+	chooseRealm := conf.ChooseRealm
+	if chooseRealm == nil && len(conf.Realm) > 0 {
+		chooseRealm = ConfiguredRealm(conf.Realm)
+	}
+	if chooseRealm != nil {
+		cl.realms = &realmChooser{fn: chooseRealm}
+		cl.realmHandle = cgo.NewHandle(cl.realms)
 	}
 	if len(conf.ExternalUsername) > 0 {
 		externalUsernameStr = C.CString(conf.ExternalUsername)
 		defer C.free(unsafe.Pointer(externalUsernameStr))
 	}
-	if len(conf.Authname) == 0 && conf.Authname != conf.Username {
-		flags |= C.SASL_NEED_PROXY
+	localAddrStr := newAddr(conf.LocalAddr)
+	defer C.free(unsafe.Pointer(localAddrStr))
+	remoteAddrStr := newAddr(conf.RemoteAddr)
+	defer C.free(unsafe.Pointer(remoteAddrStr))
+	cl.logHandle = newLogHandle(conf.Logger, conf.Password)
+	if conf.Canonicalize != nil {
+		cl.canonHandle = cgo.NewHandle(conf.Canonicalize)
 	}
-	cl.client = C.new_client(hostStr, serviceStr, usernameStr, authnameStr,
-		passwordStr, realmStr, externalUsernameStr, C.uint(conf.ExternalSsf),
-		flags, C.uint(conf.MinSsf), C.uint(conf.MaxSsf), C.uint(conf.MaxBufsize))
+	var res C.int
+	cl.client = C.new_client(hostStr, serviceStr, authzIDStr, authnameStr,
+		passwordStr, C.uintptr_t(cl.realmHandle), newOptions(conf.Options),
+		C.uintptr_t(cl.logHandle), C.uintptr_t(cl.canonHandle),
+		localAddrStr, remoteAddrStr,
+		externalUsernameStr, C.uint(conf.ExternalSsf), flags, C.uint(conf.MinSsf), C.uint(conf.MaxSsf), C.uint(conf.MaxBufsize),
+		&res)
 	if cl.client == nil {
 		cl.Free()
-		return nil, fmt.Errorf("could not create the client")
+		return nil, newError(nil, res, "NewClient")
+	}
+
+	if conf.ChannelBinding != nil {
+		cl.channelBinding = conf.ChannelBinding
+		cl.client.sc_cbinding = newChannelBinding(conf.ChannelBinding)
+		err := setChannelBinding(cl.client.sc_conn, cl.client.sc_cbinding)
+		if err != nil {
+			cl.Free()
+			return nil, err
+		}
 	}
 
 	return cl, nil
@@ -292,170 +422,421 @@ func NewClient(service, host string, conf *Config) (*Client, error) {
 
 // Start uses sasl to select a mechanism for authentication. If information is
 // needed from the user, then it is requested. If done is true, then the entire
-// interaction is done. If done is false, continue with Step.
+// interaction is done. If done is false, continue with Step. response is nil
+// if the mechanism has no initial response.
 func (cl *Client) Start(mechlist []string) (mech string, response []byte,
 	done bool, err error) {
+	return cl.StartContext(context.Background(), mechlist)
+}
+
+// StartContext is like Start, but ctx is passed to Config.Prompt. If ctx is
+// done before libsasl2 returns, the client is aborted: an error wrapping
+// ErrAborted is returned and the connection state is disposed as soon as
+// libsasl2 returns.
+func (cl *Client) StartContext(ctx context.Context, mechlist []string) (
+	mech string, response []byte, done bool, err error) {
+
+	if _, err := cl.lock("Start", StateNew); err != nil {
+		return "", nil, false, err
+	}
+	defer cl.mu.Unlock()
+
+	// only offer libsasl2 the mechanisms a required channel binding allows
+	mechs := bindingMechs(cl.channelBinding, mechlist)
+	if len(mechs) == 0 && len(mechlist) > 0 {
+		err := &Error{Op: "Start", Code: C.SASL_NOMECH,
+			Detail: "channel binding is required, but no offered " +
+				"mechanism supports it"}
+		return "", nil, false, cl.transition(stepResult{err: err})
+	}
+
+	var r stepResult
+	err = cl.run(ctx, "Start", func(sc *C.struct_SaslClient_struct) {
+		r = cl.start(ctx, sc, mechs)
+	})
+	if err != nil {
+		return "", nil, false, err
+	}
+	if err := cl.transition(r); err != nil {
+		return "", nil, false, err
+	}
+
+	return r.mech, r.response, r.done, nil
+}
 
+// Step takes another step in the authentication. Response should be sent to
+// the server, and done let's the client know that the SASL handshake is done.
+func (cl *Client) Step(challenge []byte) (response []byte, done bool,
+	err error) {
+	return cl.StepContext(context.Background(), challenge)
+}
+
+// StepContext is like Step, but ctx is passed to Config.Prompt. If ctx is
+// done before libsasl2 returns, the client is aborted like in StartContext.
+func (cl *Client) StepContext(ctx context.Context, challenge []byte) (
+	response []byte, done bool, err error) {
+
+	if _, err := cl.lock("Step", StateNegotiating); err != nil {
+		return nil, false, err
+	}
+	defer cl.mu.Unlock()
+
+	var r stepResult
+	err = cl.run(ctx, "Step", func(sc *C.struct_SaslClient_struct) {
+		r = cl.step(ctx, sc, challenge)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cl.transition(r); err != nil {
+		return nil, false, err
+	}
+
+	return r.response, r.done, nil
+}
+
+// stepResult is the outcome of a single call to sasl_client_start,
+// sasl_client_step, sasl_server_start or sasl_server_step.
+type stepResult struct {
+	mech     string
+	response []byte
+	done     bool
+	err      error
+}
+
+// run calls fn with the connection state of the client without holding
+// cl.mu, so that callbacks may call State and Free, as in runContext. cl.mu
+// must be held, and is held again when run returns. If the client was freed
+// meanwhile, its connection state is disposed and a *StateError is returned.
+// Callbacks made by fn get ctx from connContext.
+func (cl *Client) run(ctx context.Context, op string,
+	fn func(sc *C.struct_SaslClient_struct)) error {
+	// the client may be aborted while libsasl2 runs, so sc is passed on
+	sc := cl.client
+	busy := make(chan struct{})
+	cl.busy = busy
+	cl.mu.Unlock()
+
+	err := runContext(ctx, op, func() {
+		withConnContext(ctx, sc.sc_conn, func() { fn(sc) })
+	}, cl.abort)
+
+	cl.mu.Lock()
+	cl.busy = nil
+	close(busy)
+	if err != nil {
+		return err
+	}
+	if cl.state == StateFreed {
+		cl.dispose()
+		return &StateError{Op: op, State: StateFreed}
+	}
+	return nil
+}
+
+// start calls sasl_client_start on the connection of sc, answering prompts
+// until the mechanism has what it needs.
+func (cl *Client) start(ctx context.Context, sc *C.struct_SaslClient_struct,
+	mechlist []string) (r stepResult) {
+
+	conn := sc.sc_conn
 	var prompt *C.sasl_interact_t
 	var responseStr, mechStr *C.char
 	var responseLen C.uint
 	var res C.int
 
-	prompt = nil
 	mechlistExpanded := strings.Join(mechlist, ",")
 	mechlistStr := C.CString(mechlistExpanded)
 	defer C.free(unsafe.Pointer(mechlistStr))
 
 	for {
-		res = C.sasl_client_start(cl.client.sc_conn, mechlistStr,
+		res = C.sasl_client_start(conn, mechlistStr,
 			&prompt, &responseStr,
 			&responseLen, &mechStr)
 		if res != C.SASL_INTERACT {
 			break
 		}
-		doPrompt(prompt)
+		results, err := doPrompt(ctx, cl.prompt, prompt)
+		keepPrompted(sc, results)
+		if err != nil {
+			r.err = err
+			return r
+		}
 	}
 
+	if err := cl.realms.takeErr(); err != nil {
+		r.err = err
+		return r
+	}
 	if res != C.SASL_OK && res != C.SASL_CONTINUE {
-		return "", nil, false, cl.newError(res, "Client Start")
-	} else if res == C.SASL_OK {
-		cl.handshakeDone = true
+		r.err = newError(conn, res, "Start")
+		return r
 	}
 
-	response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
-	mech = C.GoString(mechStr)
-
-	return mech, response, cl.handshakeDone, nil
+	// a NULL response means there is no initial response for the server
+	if responseStr != nil {
+		r.response = C.GoBytes(unsafe.Pointer(responseStr),
+			C.int(responseLen))
+	}
+	r.mech = C.GoString(mechStr)
+	r.done = res == C.SASL_OK
+	return r
 }
 
-// Step takes another step in the authentication. Response should be sent to
-// the server, and done let's the client know that the SASL handshake is done.
-func (cl *Client) Step(challenge []byte) (response []byte, done bool,
-	err error) {
+// step calls sasl_client_step on the connection of sc, answering prompts
+// until the mechanism has what it needs.
+func (cl *Client) step(ctx context.Context, sc *C.struct_SaslClient_struct,
+	challenge []byte) (r stepResult) {
 
+	// mechanisms may refer to the results of the prompts of the previous
+	// Start or Step until this step returns
+	prompted := sc.sc_prompted
+	sc.sc_prompted = nil
+	defer C.free_options(prompted)
+
+	conn := sc.sc_conn
 	var prompt *C.sasl_interact_t
 	var responseStr *C.char
 	var responseLen C.uint
 	var res C.int
 
 	challengeStr := C.CString(string(challenge))
+	defer C.free(unsafe.Pointer(challengeStr))
 	challengeLen := C.uint(len(challenge))
 	for {
-		res = C.sasl_client_step(cl.client.sc_conn, challengeStr, challengeLen,
+		res = C.sasl_client_step(conn, challengeStr, challengeLen,
 			&prompt, &responseStr, &responseLen)
 		if res != C.SASL_INTERACT {
 			break
 		}
-		doPrompt(prompt)
+		results, err := doPrompt(ctx, cl.prompt, prompt)
+		keepPrompted(sc, results)
+		if err != nil {
+			r.err = err
+			return r
+		}
 	}
 
+	if err := cl.realms.takeErr(); err != nil {
+		r.err = err
+		return r
+	}
 	if res != C.SASL_OK && res != C.SASL_CONTINUE {
-		return nil, false, cl.newError(res, "Step")
-	} else if res == C.SASL_OK {
-		cl.handshakeDone = true
+		r.err = newError(conn, res, "Step")
+		return r
+	}
+
+	r.response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
+	r.done = res == C.SASL_OK
+	return r
+}
+
+// keepPrompted adds results to the prompt results kept by sc, which are
+// freed after the next step or with sc.
+func keepPrompted(sc *C.struct_SaslClient_struct, results []*C.char) {
+	if len(results) == 0 {
+		return
 	}
 
-	response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
+	var kept []*C.char
+	for p := sc.sc_prompted; p != nil && *p != nil; p = (**C.char)(unsafe.Add(
+		unsafe.Pointer(p), unsafe.Sizeof(*p))) {
+		kept = append(kept, *p)
+	}
+	kept = append(append(kept, results...), nil)
 
-	return response, cl.handshakeDone, nil
+	list := (**C.char)(C.malloc(C.size_t(len(kept)) *
+		C.size_t(unsafe.Sizeof(kept[0]))))
+	copy(unsafe.Slice(list, len(kept)), kept)
+	C.free(unsafe.Pointer(sc.sc_prompted))
+	sc.sc_prompted = list
+}
+
+// lock locks the client, once Start or Step returns, and returns its
+// connection. If the client is not in one of states, or has no connection,
+// it returns a *StateError and the client is left unlocked. An empty list of
+// states allows every state. A Client that was not created with NewClient is
+// treated as freed.
+func (cl *Client) lock(op string, states ...State) (*C.struct_sasl_conn,
+	error) {
+	cl.mu.Lock()
+	for cl.busy != nil {
+		busy := cl.busy
+		cl.mu.Unlock()
+		<-busy
+		cl.mu.Lock()
+	}
+	if cl.client == nil || !allowed(cl.state, states) {
+		err := &StateError{Op: op, State: cl.state}
+		if cl.client == nil && cl.state == StateNew {
+			err.State = StateFreed
+		}
+		cl.mu.Unlock()
+		return nil, err
+	}
+	return cl.client.sc_conn, nil
+}
+
+// check returns a *StateError if the client is not in one of states.
+func (cl *Client) check(op string, states ...State) error {
+	if _, err := cl.lock(op, states...); err != nil {
+		return err
+	}
+	cl.mu.Unlock()
+	return nil
+}
+
+// transition moves the client to the state that follows the step result r,
+// and returns the error of r. cl.mu must be held.
+func (cl *Client) transition(r stepResult) error {
+	switch {
+	case r.err != nil:
+		cl.state = StateFailed
+	case r.done:
+		cl.state = StateAuthenticated
+		cl.completed = time.Now()
+	default:
+		cl.state = StateNegotiating
+	}
+	return r.err
+}
+
+// abort detaches the connection state from the client and disposes it once
+// done is closed.
+func (cl *Client) abort(done <-chan struct{}) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	client, logHandle, canonHandle, realmHandle := cl.client, cl.logHandle,
+		cl.canonHandle, cl.realmHandle
+	cl.client, cl.logHandle, cl.canonHandle, cl.realmHandle = nil, 0, 0, 0
+	if cl.state != StateFreed {
+		cl.state = StateFailed
+	}
+
+	whenDone(done, func() {
+		C.free_client(client)
+		freeLogHandle(logHandle)
+		freeHandle(canonHandle)
+		freeHandle(realmHandle)
+	})
 }
 
 // Encode takes in a byteslice of data, then produces its encoded form to be
 // sent to a server.
 func (cl *Client) Encode(in []byte) ([]byte, error) {
-	if !cl.handshakeDone {
-		return nil, fmt.Errorf("handshake has not been completed yet")
+	conn, err := cl.lock("Encode", StateAuthenticated)
+	if err != nil {
+		return nil, err
 	}
+	defer cl.mu.Unlock()
 
-	return encode(cl.client.sc_conn, in)
+	return encode(conn, in)
 }
 
 // Decode decodes the b bytes from the server. This can only be called after
 // a SASL handshake has been created.
 func (cl *Client) Decode(b []byte) (out []byte, err error) {
-	if !cl.handshakeDone {
-		return nil, fmt.Errorf("handshake has not been completed yet")
+	conn, err := cl.lock("Decode", StateAuthenticated)
+	if err != nil {
+		return nil, err
 	}
+	defer cl.mu.Unlock()
 
-	return decode(cl.client.sc_conn, b)
+	return decode(conn, b)
 }
 
 // Wrap encode/decodes data over the supplied reader. This can only be called
 // after a SASL handshake has completed.
 func (cl *Client) Wrap(rw io.ReadWriter) (io.ReadWriter, error) {
-	if !cl.handshakeDone {
-		return nil, fmt.Errorf("handshake has not been completed yet")
+	if err := cl.check("Wrap", StateAuthenticated); err != nil {
+		return nil, err
 	}
 
-	return wrap(cl, rw), nil
+	return WrapReadWriter(cl, rw), nil
 }
 
 // WrapReader decodes data over the supplied reader. This can only be called
 // after a SASL handshake has completed.
 func (cl *Client) WrapReader(r io.Reader) (io.Reader, error) {
-	if !cl.handshakeDone {
-		return nil, fmt.Errorf("handshake has not been completed yet")
+	if err := cl.check("WrapReader", StateAuthenticated); err != nil {
+		return nil, err
 	}
 
-	return wrapReader(cl, r), nil
+	return WrapReader(cl, r), nil
 }
 
 // WrapWriter encodes data over the supplied writer. This can only be called
 // after a SASL handshake has completed.
 func (cl *Client) WrapWriter(w io.Writer) (io.Writer, error) {
-	if !cl.handshakeDone {
-		return nil, fmt.Errorf("handshake has not been completed yet")
+	if err := cl.check("WrapWriter", StateAuthenticated); err != nil {
+		return nil, err
 	}
 
-	return wrapWriter(cl, w), nil
+	return WrapWriter(cl, w), nil
 }
 
-// GetUsername gets the username property from the sasl connection.
+// GetUsername gets the authorization identity (SASL_USERNAME), the user the
+// connection acts as. See GetAuthUser for the authentication identity.
 func (cl *Client) GetUsername() (string, error) {
-	return getUsername(cl.client.sc_conn)
+	return cl.getString(C.SASL_USERNAME)
 }
 
 // GetSSF gets the security strength factor. If 0, then Encode/Decode are
 // unnecesary.
 func (cl *Client) GetSSF() (int, error) {
-	ssfUint, err := getSSF(cl.client.sc_conn)
+	ssfUint, err := cl.getUint(C.SASL_SSF)
 	return int(ssfUint), err
 }
 
-// Free cleans up allocated memory in the client.
-func (cl *Client) Free() {
-	if cl.client != nil {
-		C.free_client(cl.client)
-		cl.client = nil
+// Result summarizes the completed handshake. It is only valid in
+// StateAuthenticated.
+func (cl *Client) Result() (*AuthResult, error) {
+	conn, err := cl.lock("Result", StateAuthenticated)
+	if err != nil {
+		return nil, err
 	}
+	defer cl.mu.Unlock()
+
+	realm := cl.realm
+	if cl.realms != nil && cl.realms.chosen != "" {
+		realm = cl.realms.chosen
+	}
+	return newResult(conn, realm, cl.externalSSF, cl.completed)
 }
 
-// doPrompt takes user input from a prompt. If the prompt fails (i.e. if stdin
-// is closed), then the default result will be used.
-func doPrompt(prompt *C.sasl_interact_t) {
-	promptStr := C.GoString(prompt.prompt)
-	promptDefaultStr := C.GoString(prompt.defresult)
+// State returns the stage of the handshake the client is in.
+func (cl *Client) State() State {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
 
-	if len(promptDefaultStr) == 0 {
-		fmt.Printf("%s: ", promptStr)
-	} else {
-		fmt.Printf("%s [%s]: ", promptStr, promptDefaultStr)
-	}
+	return cl.state
+}
 
-	response, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	response = strings.Trim(response, "\n")
+// Free cleans up allocated memory in the client. It waits for calls into
+// libsasl2 from other goroutines to return, but for Start and Step: if they
+// are in progress, e.g. when Free is called by a callback, the connection is
+// disposed once they return, and they fail with ErrFreed.
+func (cl *Client) Free() {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
 
-	// if there is an error, then use the default.
-	if err != nil {
-		prompt.result = unsafe.Pointer(C.CString(response))
-		prompt.len = C.uint(len(response))
-	} else {
-		prompt.result = unsafe.Pointer(C.strdup(prompt.defresult))
-		prompt.len = C.uint(C.strlen(prompt.defresult))
+	cl.state = StateFreed
+	if cl.busy == nil {
+		cl.dispose()
 	}
 }
 
-// newError creates an error based on sasl_errstring / sasl_errdetail.
-func (cl *Client) newError(res C.int, msg string) error {
-	return newError(cl.client.sc_conn, res, msg)
+// dispose frees the connection state of the client. cl.mu must be held.
+func (cl *Client) dispose() {
+	if cl.client != nil {
+		C.free_client(cl.client)
+		cl.client = nil
+	}
+	freeLogHandle(cl.logHandle)
+	cl.logHandle = 0
+	freeHandle(cl.canonHandle)
+	cl.canonHandle = 0
+	freeHandle(cl.realmHandle)
+	cl.realmHandle = 0
 }
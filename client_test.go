@@ -67,3 +67,27 @@ func TestDoubleFree(t *testing.T) {
 	FreeTest(t, cl)
 	FreeTest(t, cl)
 }
+
+// TestConfigIdentities checks how Username, Authname and AuthzID combine.
+func TestConfigIdentities(t *testing.T) {
+	tests := []struct {
+		conf              Config
+		authname, authzID string
+	}{
+		{Config{Username: "user"}, "user", ""},
+		{Config{Authname: "admin"}, "admin", ""},
+		{Config{Username: "user", Authname: "user"}, "user", ""},
+		{Config{Username: "user", Authname: "admin"}, "admin", "user"},
+		{Config{Username: "user", AuthzID: "other"}, "user", "other"},
+		{Config{Username: "user", Authname: "admin", AuthzID: "other"},
+			"admin", "other"},
+	}
+
+	for _, test := range tests {
+		authname, authzID := test.conf.identities()
+		if authname != test.authname || authzID != test.authzID {
+			t.Errorf("%+v: expected %q and %q, got %q and %q", test.conf,
+				test.authname, test.authzID, authname, authzID)
+		}
+	}
+}
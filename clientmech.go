@@ -0,0 +1,210 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/saslplug.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// const char *client_simple(sasl_client_params_t *cparams, unsigned long id) {
+//     sasl_callback_ft proc = NULL;
+//     void *context = NULL;
+//     const char *result = NULL;
+//
+//     if( cparams->utils->getcallback(cparams->utils->conn, id, &proc,
+//           &context) != SASL_OK || !proc )
+//         return NULL;
+//     if( ((sasl_getsimple_t *)proc)(context, id, &result, NULL) != SASL_OK )
+//         return NULL;
+//     return result;
+// }
+//
+// sasl_secret_t *client_secret(sasl_client_params_t *cparams) {
+//     sasl_callback_ft proc = NULL;
+//     void *context = NULL;
+//     sasl_secret_t *secret = NULL;
+//
+//     if( cparams->utils->getcallback(cparams->utils->conn, SASL_CB_PASS,
+//           &proc, &context) != SASL_OK || !proc )
+//         return NULL;
+//     if( ((sasl_getsecret_t *)proc)(cparams->utils->conn, context,
+//           SASL_CB_PASS, &secret) != SASL_OK )
+//         return NULL;
+//     return secret;
+// }
+//
+// int client_canon_user(sasl_client_params_t *cparams, char *user,
+//       unsigned flags, sasl_out_params_t *oparams) {
+//     return cparams->canon_user(cparams->utils->conn, user, strlen(user),
+//           flags, oparams);
+// }
+import "C"
+import (
+	"context"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// ClientMechanism is a mechanism implemented in Go that a Client can
+// negotiate like those of the installed plugins. See
+// RegisterClientMechanism.
+type ClientMechanism interface {
+	// NewExchange begins an authentication described by params.
+	NewExchange(params *ClientParams) (ClientExchange, error)
+}
+
+// ClientExchange is a single authentication with a ClientMechanism.
+type ClientExchange interface {
+	// Step returns the response to challenge. The first step gets a nil
+	// challenge, and its response is the initial response of the client,
+	// nil if there is none. done reports that the authentication succeeded
+	// once the response is sent. An *Error selects the result code returned
+	// by Start or Step, any other error is SASL_FAIL. ctx is the context
+	// passed to StartContext or StepContext, or context.Background().
+	Step(ctx context.Context, challenge []byte) (response []byte, done bool,
+		err error)
+}
+
+// ClientParams describes the connection of a ClientExchange.
+type ClientParams struct {
+	Service    string
+	ServerFQDN string
+	ClientFQDN string
+
+	// LocalAddr and RemoteAddr are the "ip;port" addresses set by
+	// Config.LocalAddr and Config.RemoteAddr, if any.
+	LocalAddr  string
+	RemoteAddr string
+
+	ExternalSSF uint
+
+	// Authname, AuthzID and Password are the credentials of the Config of
+	// the client. Once the exchange is done, Authname and AuthzID are
+	// reported as its identities, so a mechanism may change them.
+	Authname string
+	AuthzID  string
+	Password string
+}
+
+// clientMechs holds the mechanisms passed to RegisterClientMechanism.
+var clientMechs = newRegistry("client mechanism", "RegisterClientMechanism",
+	addMech[ClientMechanism](false))
+
+// RegisterClientMechanism registers mech as the client side of the
+// mechanism info.Name, provided by the plugin info.Plugin, which defaults to
+// the name of the mechanism. Mechanisms implemented in Go have no security
+// layer, so info.MaxSSF must be 0.
+func RegisterClientMechanism(info MechanismInfo, mech ClientMechanism) error {
+	if info.MaxSSF != 0 {
+		return newError(nil, C.SASL_BADPARAM, "RegisterClientMechanism")
+	}
+	if info.Plugin == "" {
+		info.Plugin = info.Name
+	}
+	return clientMechs.register(info.Name,
+		registeredMech[ClientMechanism]{info: info, mech: mech})
+}
+
+// clientExchange is the connection context of a mechanism registered with
+// RegisterClientMechanism.
+type clientExchange struct {
+	exchange ClientExchange
+	params   ClientParams
+
+	// out is the last response, libsasl2 does not copy it.
+	out *C.char
+}
+
+// clientMechNew begins an exchange with the mechanism registered as name,
+// and returns a handle to its state.
+func clientMechNew(name string, cparams *C.sasl_client_params_t) (
+	cgo.Handle, C.int) {
+	m, ok := clientMechs.get(name)
+	if !ok {
+		return 0, C.SASL_NOMECH
+	}
+
+	ce := &clientExchange{params: newClientParams(cparams)}
+	exchange, err := m.mech.NewExchange(&ce.params)
+	if err != nil {
+		return 0, reportError(cparams.utils.conn, err, C.SASL_FAIL)
+	}
+	ce.exchange = exchange
+	return cgo.NewHandle(ce), C.SASL_OK
+}
+
+// newClientParams collects the parameters of a client connection and the
+// credentials served by its callbacks.
+func newClientParams(cparams *C.sasl_client_params_t) ClientParams {
+	params := ClientParams{
+		Service:     C.GoString(cparams.service),
+		ServerFQDN:  C.GoString(cparams.serverFQDN),
+		ClientFQDN:  C.GoString(cparams.clientFQDN),
+		LocalAddr:   C.GoString(cparams.iplocalport),
+		RemoteAddr:  C.GoString(cparams.ipremoteport),
+		ExternalSSF: uint(cparams.external_ssf),
+		Authname:    C.GoString(C.client_simple(cparams, C.SASL_CB_AUTHNAME)),
+		AuthzID:     C.GoString(C.client_simple(cparams, C.SASL_CB_USER)),
+	}
+	if secret := C.client_secret(cparams); secret != nil {
+		params.Password = C.GoStringN(
+			(*C.char)(unsafe.Pointer(&secret.data[0])), C.int(secret.len))
+	}
+	return params
+}
+
+// clientMechStep runs a step of the exchange of handle. Once it is done, the
+// identities of its params are canonicalized into oparams.
+func clientMechStep(handle cgo.Handle, cparams *C.sasl_client_params_t,
+	challenge []byte, clientout **C.char, clientoutlen *C.uint,
+	oparams *C.sasl_out_params_t) C.int {
+	ce := handle.Value().(*clientExchange)
+
+	response, done, err := ce.exchange.Step(connContext(cparams.utils.conn),
+		challenge)
+	if err != nil {
+		return reportError(cparams.utils.conn, err, C.SASL_FAIL)
+	}
+
+	C.free(unsafe.Pointer(ce.out))
+	ce.out = nil
+	if response != nil {
+		ce.out = C.CString(string(response))
+	}
+	*clientout = ce.out
+	*clientoutlen = C.uint(len(response))
+	if !done {
+		return C.SASL_CONTINUE
+	}
+
+	authname, authzID := ce.params.Authname, ce.params.AuthzID
+	if authzID == "" {
+		authzID = authname
+	}
+	authnameStr := C.CString(authname)
+	defer C.free(unsafe.Pointer(authnameStr))
+	authzIDStr := C.CString(authzID)
+	defer C.free(unsafe.Pointer(authzIDStr))
+	res := C.client_canon_user(cparams, authzIDStr, C.SASL_CU_AUTHZID,
+		oparams)
+	if res != C.SASL_OK {
+		return res
+	}
+	res = C.client_canon_user(cparams, authnameStr, C.SASL_CU_AUTHID,
+		oparams)
+	if res != C.SASL_OK {
+		return res
+	}
+
+	oparams.doneflag = 1
+	oparams.mech_ssf = 0
+	oparams.encode = nil
+	oparams.decode = nil
+	return C.SASL_OK
+}
+
+// dispose frees the last response.
+func (ce *clientExchange) dispose() {
+	C.free(unsafe.Pointer(ce.out))
+}
@@ -0,0 +1,178 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testMechanism sends the authentication identity, then answers the
+// challenge of the server with the password and the challenge. The
+// challenge "wait" is answered with the error of ctx once it is done, which
+// is also sent on waitedSteps.
+type testMechanism struct{}
+
+// waitedSteps receives the errors of the contexts of "wait" challenges.
+var waitedSteps = make(chan error, 1)
+
+// NewExchange implements ClientMechanism.
+func (testMechanism) NewExchange(params *ClientParams) (ClientExchange,
+	error) {
+	return &testExchange{params: params}, nil
+}
+
+// testExchange is an exchange of testMechanism.
+type testExchange struct {
+	params *ClientParams
+	steps  int
+}
+
+// Step implements ClientExchange.
+func (te *testExchange) Step(ctx context.Context, challenge []byte) ([]byte,
+	bool, error) {
+	te.steps++
+	switch {
+	case te.steps == 1:
+		return []byte(te.params.Authname), false, nil
+	case bytes.Equal(challenge, []byte("fail")):
+		return nil, false, ErrBadProt
+	case bytes.Equal(challenge, []byte("wait")):
+		<-ctx.Done()
+		waitedSteps <- ctx.Err()
+		return nil, false, ctx.Err()
+	}
+	return []byte(te.params.Password + ":" + string(challenge)), true, nil
+}
+
+// testMechanismInfo describes the mechanisms implemented in the tests.
+var testMechanismInfo = MechanismInfo{Name: "X-GO-TEST", Plugin: "gosasltest"}
+
+var registerTestMechanisms sync.Once
+
+// RegisterTestMechanisms registers the client and server sides of
+// X-GO-TEST, and the user store its server checks passwords against.
+func RegisterTestMechanisms(t *testing.T) {
+	registerTestMechanisms.Do(func() {
+		err := RegisterClientMechanism(testMechanismInfo, testMechanism{})
+		if err != nil {
+			t.Fatalf("could not register the client mechanism: %v", err)
+		}
+		err = RegisterServerMechanism(testMechanismInfo,
+			testServerMechanism{})
+		if err != nil {
+			t.Fatalf("could not register the server mechanism: %v", err)
+		}
+		err = RegisterUserStore("gosasltest",
+			passwordStore{"alice@hostname": "secret", "carol@hostname": "",
+				"bob@example.com": "secret"})
+		if err != nil {
+			t.Fatalf("could not register the store: %v", err)
+		}
+	})
+}
+
+// TestClientMechanism negotiates a mechanism implemented in Go, also after
+// the library is initialized again.
+func TestClientMechanism(t *testing.T) {
+	RegisterTestMechanisms(t)
+	err := RegisterClientMechanism(testMechanismInfo, testMechanism{})
+	if !errors.Is(err, ErrRegistered) {
+		t.Errorf("expected ErrRegistered, got %v", err)
+	}
+	err = RegisterClientMechanism(MechanismInfo{Name: "X-GO-SSF", MaxSSF: 56},
+		testMechanism{})
+	if !errors.Is(err, ErrBadParam) {
+		t.Errorf("expected ErrBadParam, got %v", err)
+	}
+
+	for _, reinit := range []bool{false, true} {
+		if reinit {
+			if err := Shutdown(); err != nil {
+				t.Fatalf("could not shut down: %v", err)
+			}
+		}
+
+		infos, err := ListClientMechanisms()
+		if err != nil {
+			t.Fatalf("could not list mechanisms: %v", err)
+		}
+		found := false
+		for _, mi := range infos {
+			found = found || mi.Name == "X-GO-TEST" && mi.Plugin == "gosasltest"
+		}
+		if !found {
+			t.Errorf("X-GO-TEST is not listed in %v", infos)
+		}
+
+		cl, err := NewClient("service", "hostname", &Config{
+			Username: "alice",
+			Password: "secret",
+		})
+		if err != nil {
+			t.Fatalf("could not create client: %v", err)
+		}
+		mech, response, done, err := cl.Start([]string{"X-GO-TEST"})
+		if err != nil || mech != "X-GO-TEST" || done {
+			t.Fatalf("unexpected start %v, %v, %v", mech, done, err)
+		}
+		if string(response) != "alice" {
+			t.Errorf("expected alice, got %q", response)
+		}
+		response, done, err = cl.Step([]byte("nonce"))
+		if err != nil || !done {
+			t.Fatalf("unexpected step %v, %v", done, err)
+		}
+		if string(response) != "secret:nonce" {
+			t.Errorf("expected secret:nonce, got %q", response)
+		}
+		r, err := cl.Result()
+		if err != nil {
+			t.Fatalf("could not get the result: %v", err)
+		}
+		if r.Mechanism != "X-GO-TEST" || r.AuthnID != "alice" {
+			t.Errorf("unexpected result %+v", r)
+		}
+		cl.Free()
+	}
+
+	cl := NewPlainClient(t)
+	defer cl.Free()
+	if _, _, _, err := cl.Start([]string{"X-GO-TEST"}); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	if _, _, err := cl.Step([]byte("fail")); !errors.Is(err, ErrBadProt) {
+		t.Errorf("expected ErrBadProt, got %v", err)
+	}
+}
+
+// TestClientMechanismContext aborts a step of a mechanism implemented in Go,
+// which sees the context of the step.
+func TestClientMechanismContext(t *testing.T) {
+	RegisterTestMechanisms(t)
+	cl := NewPlainClient(t)
+	defer cl.Free()
+	if _, _, _, err := cl.Start([]string{"X-GO-TEST"}); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	_, _, err := cl.StepContext(ctx, []byte("wait"))
+	if !errors.Is(err, ErrAborted) ||
+		!errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an aborted step, got %v", err)
+	}
+
+	select {
+	case err := <-waitedSteps:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the step to see the deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the step did not see the end of the handshake")
+	}
+}
@@ -4,54 +4,182 @@ package sasl
 // #cgo CFLAGS: -Wall
 // #include <sasl/sasl.h>
 // #include <stdio.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// char **new_options(unsigned n) {
+//     char **opts = (char **)malloc(sizeof(char *)*(2*n+1));
+//     memset(opts, 0, sizeof(char *)*(2*n+1));
+//     return opts;
+// }
+//
+// void set_option(char **opts, unsigned i, char *key, char *value) {
+//     opts[2*i]   = key;
+//     opts[2*i+1] = value;
+// }
+//
+// void free_options(char **opts) {
+//     char **iter;
+//
+//     if( !opts )
+//         return;
+//
+//     for( iter = opts; *iter; iter++ )
+//         free(*iter);
+//     free(opts);
+// }
+//
+// int cb_getopt(char **opts, const char *plugin_name, const char *option,
+//       const char **result, unsigned *len) {
+//     char **iter;
+//
+//     for( iter = opts; *iter; iter += 2 ) {
+//         if( strcmp(*iter, option) == 0 ) {
+//             *result = *(iter+1);
+//             if( len )
+//                 *len = strlen(*result);
+//             return SASL_OK;
+//         }
+//     }
+//     return SASL_FAIL;
+// }
 //
 // int getprop_uint(sasl_conn_t *conn, int propnum, unsigned *ret_num) {
 //     int ret;
 //     unsigned *ret_num_ptr;
 //     ret = sasl_getprop(conn, propnum, (const void **)&ret_num_ptr);
-//     *ret_num = *ret_num_ptr;
+//     if( ret == SASL_OK && ret_num_ptr )
+//         *ret_num = *ret_num_ptr;
 //     return ret;
 // }
 import "C"
 import (
-	"fmt"
+	"net"
 	"unsafe"
 )
 
+// newOptions copies options into a NULL terminated array of alternating keys
+// and values for cb_getopt. It returns nil if there are no options.
+func newOptions(options map[string]string) **C.char {
+	if len(options) == 0 {
+		return nil
+	}
+
+	opts := C.new_options(C.uint(len(options)))
+	i := C.uint(0)
+	for key, value := range options {
+		C.set_option(opts, i, C.CString(key), C.CString(value))
+		i++
+	}
+	return opts
+}
+
+// goStrings copies a NULL terminated array of strings.
+func goStrings(list **C.char) []string {
+	if list == nil {
+		return nil
+	}
+
+	var strs []string
+	for p := list; *p != nil; p = (**C.char)(unsafe.Add(unsafe.Pointer(p),
+		unsafe.Sizeof(*p))) {
+		strs = append(strs, C.GoString(*p))
+	}
+	return strs
+}
+
+// FormatAddr formats addr the way libsasl2 expects IP addresses:
+// "a.b.c.d;port" for IPv4 and "e:f:g:h::i;port" for IPv6. It returns "" for
+// addresses without a host and port, such as Unix domain sockets.
+func FormatAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil || host == "" || port == "" {
+		return ""
+	}
+	return host + ";" + port
+}
+
+// newAddr formats addr into a C string with FormatAddr. It returns nil if
+// addr cannot be formatted.
+func newAddr(addr net.Addr) *C.char {
+	addrStr := FormatAddr(addr)
+	if addrStr == "" {
+		return nil
+	}
+	return C.CString(addrStr)
+}
+
 // getPropString collects a property from a connection as a string.
 func getPropString(conn *C.struct_sasl_conn, prop C.int) (string, error) {
-	var retStr *C.char
-	p := unsafe.Pointer(retStr)
+	var p unsafe.Pointer
 	res := C.sasl_getprop(conn, prop, &p)
 	if res != C.SASL_OK {
 		return "", newError(conn, res, "getPropString")
 	}
-	return C.GoString(retStr), nil
+	return C.GoString((*C.char)(p)), nil
 }
 
-// getPropUint collects a property from a connection as a uint.
-func getPropUint(conn *C.struct_sasl_conn, prop C.int) (uint, error) {
-	retInt := C.uint(1)
-	res := C.getprop_uint(conn, prop, &retInt)
+// setPropString sets a string property on a connection. libsasl2 copies the
+// value, so it is freed before returning.
+func setPropString(conn *C.struct_sasl_conn, prop C.int, value string) error {
+	valueStr := C.CString(value)
+	defer C.free(unsafe.Pointer(valueStr))
+
+	res := C.sasl_setprop(conn, prop, unsafe.Pointer(valueStr))
 	if res != C.SASL_OK {
-		return 0, newError(conn, res, "getPropUint")
+		return newError(conn, res, "setPropString")
 	}
-	return uint(retInt), nil
+	return nil
 }
 
-// getUsername collects the SASL_USERNAME property from the connection.
-func getUsername(conn *C.struct_sasl_conn) (string, error) {
-	return getPropString(conn, C.SASL_USERNAME)
+// setPropUint sets an unsigned property, such as SASL_SSF_EXTERNAL, on a
+// connection.
+func setPropUint(conn *C.struct_sasl_conn, prop C.int, value uint) error {
+	valueUint := C.uint(value)
+
+	res := C.sasl_setprop(conn, prop, unsafe.Pointer(&valueUint))
+	if res != C.SASL_OK {
+		return newError(conn, res, "setPropUint")
+	}
+	return nil
 }
 
-// getMaxOutBuf collects the SASL_MAXOUTBUF property from the connection.
-func getMaxOutBuf(conn *C.struct_sasl_conn) (uint, error) {
-	return getPropUint(conn, C.SASL_MAXOUTBUF)
+// setExternal sets the SASL_AUTH_EXTERNAL and SASL_SSF_EXTERNAL properties
+// on a connection.
+func setExternal(conn *C.struct_sasl_conn, username string, ssf uint32) error {
+	if err := setPropString(conn, C.SASL_AUTH_EXTERNAL, username); err != nil {
+		return err
+	}
+	return setPropUint(conn, C.SASL_SSF_EXTERNAL, uint(ssf))
+}
+
+// setSecProps sets the SASL_SEC_PROPS property on a connection.
+func setSecProps(conn *C.struct_sasl_conn, minSsf, maxSsf,
+	maxBufsize uint32) error {
+	var props C.sasl_security_properties_t
+	props.min_ssf = C.sasl_ssf_t(minSsf)
+	props.max_ssf = C.sasl_ssf_t(maxSsf)
+	props.maxbufsize = C.unsigned(maxBufsize)
+
+	res := C.sasl_setprop(conn, C.SASL_SEC_PROPS, unsafe.Pointer(&props))
+	if res != C.SASL_OK {
+		return newError(conn, res, "setSecProps")
+	}
+	return nil
 }
 
-// getSSF collects the SASL_SSF property from the connection.
-func getSSF(conn *C.struct_sasl_conn) (uint, error) {
-	return getPropUint(conn, C.SASL_SSF)
+// getPropUint collects a property from a connection as a uint.
+func getPropUint(conn *C.struct_sasl_conn, prop C.int) (uint, error) {
+	retInt := C.uint(0)
+	res := C.getprop_uint(conn, prop, &retInt)
+	if res != C.SASL_OK {
+		return 0, newError(conn, res, "getPropUint")
+	}
+	return uint(retInt), nil
 }
 
 func encode(conn *C.struct_sasl_conn, buf []byte) (out []byte, err error) {
@@ -88,17 +216,3 @@ func decode(conn *C.struct_sasl_conn, buf []byte) (out []byte,
 	out = C.GoBytes(unsafe.Pointer(outputStr), C.int(outputLen))
 	return out, nil
 }
-
-// newError creates a new error from a connection result.
-func newError(conn *C.struct_sasl_conn, res C.int, msg string) error {
-	var errMsgStr *C.char
-
-	if conn == nil {
-		errMsgStr = C.sasl_errstring(res, nil, nil)
-	} else {
-		errMsgStr = C.sasl_errdetail(conn)
-	}
-
-	errMsg := C.GoString(errMsgStr)
-	return fmt.Errorf("err in %v: %v\n", msg, errMsg)
-}
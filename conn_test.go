@@ -0,0 +1,42 @@
+package sasl
+
+import (
+	"net"
+	"testing"
+)
+
+// TestFormatAddr checks the libsasl2 form of IPv4, IPv6 and Unix addresses.
+func TestFormatAddr(t *testing.T) {
+	tests := []struct {
+		addr net.Addr
+		want string
+	}{
+		{&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 143}, "192.0.2.1;143"},
+		{&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 993},
+			"2001:db8::1;993"},
+		{&net.UnixAddr{Name: "/run/app.sock", Net: "unix"}, ""},
+		{nil, ""},
+	}
+
+	for _, test := range tests {
+		if got := FormatAddr(test.addr); got != test.want {
+			t.Errorf("FormatAddr(%v) = %q, want %q", test.addr, got, test.want)
+		}
+	}
+}
+
+// TestServerAddrs creates a server with its connection addresses.
+func TestServerAddrs(t *testing.T) {
+	ss := NewTestServer(t, &ServerConfig{
+		LocalAddr:  &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234},
+		RemoteAddr: &net.TCPAddr{IP: net.ParseIP("::1"), Port: 5678},
+	})
+	defer ss.Free()
+
+	if addr, err := ss.GetIPLocalPort(); err != nil || addr != "127.0.0.1;1234" {
+		t.Errorf("unexpected local address %q: %v", addr, err)
+	}
+	if addr, err := ss.GetIPRemotePort(); err != nil || addr != "::1;5678" {
+		t.Errorf("unexpected remote address %q: %v", addr, err)
+	}
+}
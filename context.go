@@ -0,0 +1,108 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gopkg.in/freddierice/go-sasl.v4/session"
+)
+
+// ErrAborted is session.ErrAborted.
+var ErrAborted = session.ErrAborted
+
+// runContext runs fn, which calls into libsasl2, until it returns or ctx is
+// done. libsasl2 cannot be interrupted, so if ctx is done first, abort is
+// called with a channel that is closed once fn has returned, and the
+// connection state must not be used from then on.
+func runContext(ctx context.Context, op string, fn func(),
+	abort func(done <-chan struct{})) error {
+	if ctx.Done() == nil {
+		fn()
+		return nil
+	}
+
+	done := make(chan struct{})
+	if err := ctx.Err(); err != nil {
+		close(done)
+		abort(done)
+		return abortedError(op, err)
+	}
+
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		abort(done)
+		return abortedError(op, ctx.Err())
+	}
+}
+
+// connContexts holds the context of every connection that a call into
+// libsasl2 is running on, for the callbacks made during the call.
+var (
+	connContextsMu sync.RWMutex
+	connContexts   = make(map[*C.sasl_conn_t]context.Context)
+)
+
+// withConnContext runs fn, which calls into libsasl2 on conn, with ctx as
+// the context of the callbacks made on conn.
+func withConnContext(ctx context.Context, conn *C.sasl_conn_t, fn func()) {
+	connContextsMu.Lock()
+	connContexts[conn] = ctx
+	connContextsMu.Unlock()
+
+	defer func() {
+		connContextsMu.Lock()
+		delete(connContexts, conn)
+		connContextsMu.Unlock()
+	}()
+	fn()
+}
+
+// connContext returns the context of the call running on conn, or
+// context.Background() if there is none.
+func connContext(conn *C.sasl_conn_t) context.Context {
+	connContextsMu.RLock()
+	defer connContextsMu.RUnlock()
+
+	if ctx, ok := connContexts[conn]; ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// abortedError creates the error returned when op is aborted because of err.
+func abortedError(op string, err error) error {
+	return fmt.Errorf("%w: %v: %w", ErrAborted, op, err)
+}
+
+// disposals counts the aborted connections that are still waiting for
+// libsasl2 to return, so that Shutdown can wait for them.
+var disposals sync.WaitGroup
+
+// whenDone calls dispose once done is closed. If done is already closed, as
+// when ctx was canceled before libsasl2 was called, dispose runs before
+// whenDone returns.
+func whenDone(done <-chan struct{}, dispose func()) {
+	select {
+	case <-done:
+		dispose()
+	default:
+		disposals.Add(1)
+		go func() {
+			defer disposals.Done()
+			<-done
+			dispose()
+		}()
+	}
+}
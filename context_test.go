@@ -0,0 +1,132 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// testContextKey is the key of the values the tests add to the contexts
+// they pass, to check that callbacks get them.
+type testContextKey struct{}
+
+// TestStartContextPrompt answers the prompts of a mechanism with a
+// PromptFunc.
+func TestStartContextPrompt(t *testing.T) {
+	prompted := map[PromptID]bool{}
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "user",
+		Authname: "user",
+		Prompt: func(ctx context.Context, p Prompt) (string, error) {
+			t.Logf("prompt %v", p)
+			prompted[p.ID] = true
+			if p.ID == PromptPass {
+				return "secret", nil
+			}
+			return "user", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	mech, response, _, err := cl.StartContext(context.Background(),
+		[]string{"PLAIN"})
+	if err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	if mech != "PLAIN" || !bytes.Contains(response, []byte("secret")) {
+		t.Errorf("unexpected response for %v: %q", mech, response)
+	}
+	if !prompted[PromptPass] {
+		t.Errorf("password was not prompted for: %v", prompted)
+	}
+}
+
+// TestStepPrompt answers the prompts of LOGIN, which asks for the user name
+// and the password in separate steps, and checks that prompt results are
+// kept until the following step returns.
+func TestStepPrompt(t *testing.T) {
+	cl, err := NewClient("service", "hostname", &Config{
+		Prompt: func(ctx context.Context, p Prompt) (string, error) {
+			if p.ID == PromptPass {
+				return "secret", nil
+			}
+			return "prompted", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	if _, _, _, err := cl.Start([]string{"LOGIN"}); err != nil {
+		t.Fatalf("could not start LOGIN: %v", err)
+	}
+	for _, step := range []struct {
+		challenge, response string
+	}{
+		{"Username:", "prompted"},
+		{"Password:", "secret"},
+	} {
+		response, _, err := cl.Step([]byte(step.challenge))
+		if err != nil {
+			t.Fatalf("could not step: %v", err)
+		}
+		if string(response) != step.response {
+			t.Errorf("expected %q, got %q", step.response, response)
+		}
+		kept := goStrings(cl.client.sc_prompted)
+		if !slices.Equal(kept, []string{step.response}) {
+			t.Errorf("expected only %q to be kept, got %q", step.response,
+				kept)
+		}
+	}
+}
+
+// TestStartContextDeadline aborts a handshake that is blocked in a prompt.
+func TestStartContextDeadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "user",
+		Authname: "user",
+		Prompt: func(ctx context.Context, p Prompt) (string, error) {
+			t.Logf("prompt %v", p)
+			<-release
+			return "", errors.New("released")
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		10*time.Millisecond)
+	defer cancel()
+
+	_, _, _, err = cl.StartContext(ctx, []string{"PLAIN"})
+	if !errors.Is(err, ErrAborted) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an aborted handshake, got %v", err)
+	}
+}
+
+// TestStartContextCanceled aborts a server handshake with a canceled context.
+func TestStartContextCanceled(t *testing.T) {
+	ss := NewTestServer(t, nil)
+	defer ss.Free()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := ss.StartContext(ctx, "PLAIN", nil)
+	if !errors.Is(err, ErrAborted) || !errors.Is(err, context.Canceled) {
+		t.Errorf("expected an aborted handshake, got %v", err)
+	}
+}
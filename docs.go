@@ -1,9 +1,26 @@
-// sasl is a wrapper for the cyrus sasl library written for go.
-// Right now it only supports clients, but that could change in the future.
-// It is meant as a simple interface for interacting with a multitude of
-// authentication mechanisms. Use it just as you would the C library --
-// initialize a Client, call the client's Start method, then keep calling
-// Step until the authentication has completed. After Client is done, call
-// its Free method to cleanup any extra memory resources. The library was
-// written such that multiple calls to Free is ok.
+// sasl is a wrapper for the cyrus sasl library written for go. It is meant
+// as a simple interface for interacting with a multitude of authentication
+// mechanisms, on both the client and the server side.
+//
+// Call Init once to configure libsasl2, e.g. its application name and plugin
+// path, before creating any Client or Server; otherwise the library is
+// initialized with the default Options on first use. Shutdown releases
+// libsasl2 once every Client and Server is freed, after which Init may be
+// called again.
+//
+// Use the API just as you would the C library. A client is created with
+// NewClient, calls Start with the mechanisms offered by the server, then
+// keeps calling Step until the authentication has completed. A server is
+// created with NewServerWithConfig, lists its mechanisms with ListMech, then
+// calls Start with the mechanism chosen by the client and Step until done.
+// StartContext and StepContext abort a handshake when their context is done.
+// Afterwards, Result describes the authentication and Wrap protects the
+// connection with the security layer, if one was negotiated.
+//
+// Mechanisms and password backends written in go are added with
+// RegisterClientMechanism, RegisterServerMechanism and RegisterUserStore.
+//
+// When a Client or Server is done, call its Free method to cleanup any extra
+// memory resources. The library was written such that multiple calls to Free
+// is ok.
 package sasl
@@ -0,0 +1,79 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+import "gopkg.in/freddierice/go-sasl.v4/session"
+
+// Error is session.Error.
+type Error = session.Error
+
+// The sentinel errors of package session.
+var (
+	ErrFail             = session.ErrFail
+	ErrNoMem            = session.ErrNoMem
+	ErrBufOver          = session.ErrBufOver
+	ErrNoMech           = session.ErrNoMech
+	ErrBadProt          = session.ErrBadProt
+	ErrNotDone          = session.ErrNotDone
+	ErrBadParam         = session.ErrBadParam
+	ErrTryAgain         = session.ErrTryAgain
+	ErrBadMAC           = session.ErrBadMAC
+	ErrBadServ          = session.ErrBadServ
+	ErrWrongMech        = session.ErrWrongMech
+	ErrNotInit          = session.ErrNotInit
+	ErrBadAuth          = session.ErrBadAuth
+	ErrNoAuthz          = session.ErrNoAuthz
+	ErrTooWeak          = session.ErrTooWeak
+	ErrEncrypt          = session.ErrEncrypt
+	ErrTrans            = session.ErrTrans
+	ErrExpired          = session.ErrExpired
+	ErrDisabled         = session.ErrDisabled
+	ErrNoUser           = session.ErrNoUser
+	ErrBadVers          = session.ErrBadVers
+	ErrUnavail          = session.ErrUnavail
+	ErrNoVerify         = session.ErrNoVerify
+	ErrPwLock           = session.ErrPwLock
+	ErrNoChange         = session.ErrNoChange
+	ErrWeakPass         = session.ErrWeakPass
+	ErrNoUserPass       = session.ErrNoUserPass
+	ErrNeedOldPasswd    = session.ErrNeedOldPasswd
+	ErrConstraintViolat = session.ErrConstraintViolat
+	ErrBadBinding       = session.ErrBadBinding
+	ErrConfigErr        = session.ErrConfigErr
+)
+
+// ErrFreed is session.ErrFreed.
+var ErrFreed = session.ErrFreed
+
+// IsAuthFailure calls session.IsAuthFailure.
+func IsAuthFailure(err error) bool {
+	return session.IsAuthFailure(err)
+}
+
+// IsTemporary calls session.IsTemporary.
+func IsTemporary(err error) bool {
+	return session.IsTemporary(err)
+}
+
+// errstring returns the description libsasl2 has for a result code.
+func errstring(code int) string {
+	return C.GoString(C.sasl_errstring(C.int(code), nil, nil))
+}
+
+// newError creates a new error from a connection result.
+func newError(conn *C.struct_sasl_conn, res C.int, op string) error {
+	var detail string
+	if conn == nil {
+		detail = errstring(int(res))
+	} else {
+		detail = C.GoString(C.sasl_errdetail(conn))
+	}
+
+	return &Error{
+		Op:     op,
+		Code:   int(res),
+		Detail: detail,
+	}
+}
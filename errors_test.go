@@ -0,0 +1,65 @@
+package sasl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestErrorIs checks that errors match their sentinel by result code.
+func TestErrorIs(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &Error{Op: "Step", Code: ErrBadAuth.Code,
+		Detail: "authentication failure"})
+
+	if !errors.Is(err, ErrBadAuth) {
+		t.Errorf("expected %v to match ErrBadAuth", err)
+	}
+	if errors.Is(err, ErrNoMech) {
+		t.Errorf("did not expect %v to match ErrNoMech", err)
+	}
+
+	var saslErr *Error
+	if !errors.As(err, &saslErr) || saslErr.Op != "Step" {
+		t.Errorf("could not recover *Error from %v", err)
+	}
+}
+
+// TestErrorClassification checks IsAuthFailure and IsTemporary.
+func TestErrorClassification(t *testing.T) {
+	if !IsAuthFailure(ErrNoUser) || IsAuthFailure(ErrTryAgain) {
+		t.Errorf("IsAuthFailure misclassified an error")
+	}
+	if !IsTemporary(ErrTryAgain) || IsTemporary(ErrBadAuth) {
+		t.Errorf("IsTemporary misclassified an error")
+	}
+	if IsAuthFailure(errors.New("other")) || IsTemporary(nil) {
+		t.Errorf("non-sasl errors should not be classified")
+	}
+}
+
+// TestSentinels checks the result codes of the sentinel errors against the
+// descriptions of libsasl2.
+func TestSentinels(t *testing.T) {
+	sentinels := []*Error{ErrFail, ErrNoMem, ErrBufOver, ErrNoMech,
+		ErrBadProt, ErrNotDone, ErrBadParam, ErrTryAgain, ErrBadMAC,
+		ErrBadServ, ErrWrongMech, ErrNotInit, ErrBadAuth, ErrNoAuthz,
+		ErrTooWeak, ErrEncrypt, ErrTrans, ErrExpired, ErrDisabled, ErrNoUser,
+		ErrBadVers, ErrUnavail, ErrNoVerify, ErrPwLock, ErrNoChange,
+		ErrWeakPass, ErrNoUserPass, ErrNeedOldPasswd, ErrConstraintViolat,
+		ErrBadBinding, ErrConfigErr}
+	for _, e := range sentinels {
+		if detail := errstring(e.Code); e.Detail != detail {
+			t.Errorf("code %d is %q, not %q", e.Code, detail, e.Detail)
+		}
+	}
+}
+
+// TestHandshakeNotDone checks that the handshake guards return ErrNotDone.
+func TestHandshakeNotDone(t *testing.T) {
+	cl := NewTestClient(t)
+	defer cl.Free()
+
+	if _, err := cl.Encode([]byte("data")); !errors.Is(err, ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+}
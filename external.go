@@ -0,0 +1,135 @@
+package sasl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+// IdentityFunc maps a verified certificate to the identity used for EXTERNAL
+// authentication (SASL_AUTH_EXTERNAL).
+type IdentityFunc func(cert *x509.Certificate) (string, error)
+
+// SubjectDN is an IdentityFunc that uses the subject distinguished name of
+// the certificate, e.g. "CN=alice,O=Example".
+func SubjectDN(cert *x509.Certificate) (string, error) {
+	return cert.Subject.String(), nil
+}
+
+// CommonName is an IdentityFunc that uses the common name of the certificate
+// subject.
+func CommonName(cert *x509.Certificate) (string, error) {
+	if cert.Subject.CommonName == "" {
+		return "", errors.New("sasl: certificate has no common name")
+	}
+	return cert.Subject.CommonName, nil
+}
+
+// EmailSAN is an IdentityFunc that uses the first email address in the
+// subject alternative names of the certificate.
+func EmailSAN(cert *x509.Certificate) (string, error) {
+	if len(cert.EmailAddresses) == 0 {
+		return "", errors.New("sasl: certificate has no email address")
+	}
+	return cert.EmailAddresses[0], nil
+}
+
+// tlsCipherSSF is the key length of the ciphers of the TLS cipher suites
+// implemented by crypto/tls.
+var tlsCipherSSF = map[uint16]uint32{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                      128,
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:                 112,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:                  128,
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:                  256,
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:               128,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               128,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               256,
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:              128,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:          128,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:          256,
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:                128,
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:           112,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:            128,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:            256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256:       128,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:         128,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         128,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       128,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   256,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: 256,
+	tls.TLS_AES_128_GCM_SHA256:                        128,
+	tls.TLS_AES_256_GCM_SHA384:                        256,
+	tls.TLS_CHACHA20_POLY1305_SHA256:                  256,
+}
+
+// TLSExternalSSF returns the security strength factor of a TLS connection,
+// the key length of its cipher. It returns 0 if state is nil or the cipher
+// suite is not known.
+func TLSExternalSSF(state *tls.ConnectionState) uint32 {
+	if state == nil {
+		return 0
+	}
+	return tlsCipherSSF[state.CipherSuite]
+}
+
+// tlsExternal derives the external identity and SSF from cert and state.
+func tlsExternal(state *tls.ConnectionState, cert *x509.Certificate,
+	identity IdentityFunc) (string, uint32, error) {
+	if identity == nil {
+		identity = SubjectDN
+	}
+
+	username, err := identity(cert)
+	if err != nil {
+		return "", 0, err
+	}
+	return username, TLSExternalSSF(state), nil
+}
+
+// SetTLSExternal fills in ExternalUsername and ExternalSsf from a completed
+// TLS handshake, so that the EXTERNAL mechanism can be used. cert is the
+// certificate the client presented to the server and identity maps it to
+// the external identity; if identity is nil, SubjectDN is used.
+func (conf *Config) SetTLSExternal(state *tls.ConnectionState,
+	cert *x509.Certificate, identity IdentityFunc) error {
+	if state == nil || !state.HandshakeComplete {
+		return errors.New("sasl: TLS handshake has not been completed")
+	}
+	if cert == nil {
+		return errors.New("sasl: no client certificate")
+	}
+
+	username, ssf, err := tlsExternal(state, cert, identity)
+	if err != nil {
+		return err
+	}
+	conf.ExternalUsername = username
+	conf.ExternalSsf = ssf
+	return nil
+}
+
+// SetTLSExternal fills in ExternalUsername and ExternalSsf from a completed
+// TLS handshake, so that the EXTERNAL mechanism can be used. The client
+// certificate must have been verified, e.g. with tls.RequireAndVerifyClientCert.
+// identity maps it to the external identity; if identity is nil, SubjectDN
+// is used.
+func (conf *ServerConfig) SetTLSExternal(state *tls.ConnectionState,
+	identity IdentityFunc) error {
+	if state == nil || !state.HandshakeComplete {
+		return errors.New("sasl: TLS handshake has not been completed")
+	}
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return errors.New("sasl: client certificate has not been verified")
+	}
+
+	username, ssf, err := tlsExternal(state, state.VerifiedChains[0][0],
+		identity)
+	if err != nil {
+		return err
+	}
+	conf.ExternalUsername = username
+	conf.ExternalSsf = ssf
+	return nil
+}
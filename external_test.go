@@ -0,0 +1,119 @@
+package sasl
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+)
+
+// TestTLSExternal derives the EXTERNAL identity of both ends of a mutually
+// authenticated TLS connection.
+func TestTLSExternal(t *testing.T) {
+	cert := NewTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	clientState, serverState := TLSLoopback(t,
+		&tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool,
+			ClientAuth: tls.RequireAndVerifyClientCert},
+		&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool,
+			ServerName: "localhost"})
+
+	serverConf := &ServerConfig{}
+	if err := serverConf.SetTLSExternal(&serverState, CommonName); err != nil {
+		t.Fatalf("could not set server external: %v", err)
+	}
+	if serverConf.ExternalUsername != "localhost" || serverConf.ExternalSsf == 0 {
+		t.Errorf("unexpected server external: %+v", serverConf)
+	}
+
+	ss := NewTestServer(t, serverConf)
+	defer ss.Free()
+
+	mechs, err := ss.ListMech()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+	hasExternal := false
+	for _, mech := range mechs {
+		hasExternal = hasExternal || mech == "EXTERNAL"
+	}
+	if !hasExternal {
+		t.Errorf("EXTERNAL is not offered: %v", mechs)
+	}
+
+	clientConf := &Config{}
+	err = clientConf.SetTLSExternal(&clientState, cert.Leaf, nil)
+	if err != nil {
+		t.Fatalf("could not set client external: %v", err)
+	}
+	if clientConf.ExternalUsername != "CN=localhost" {
+		t.Errorf("unexpected client external: %+v", clientConf)
+	}
+
+	cl, err := NewClient("service", "hostname", clientConf)
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	mech, _, _, err := cl.Start([]string{"EXTERNAL"})
+	if err != nil || mech != "EXTERNAL" {
+		t.Errorf("could not start EXTERNAL (%v): %v", mech, err)
+	}
+}
+
+// TestTLSExternalUnverified refuses unverified client certificates.
+func TestTLSExternalUnverified(t *testing.T) {
+	cert := NewTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	_, serverState := TLSLoopback(t,
+		&tls.Config{Certificates: []tls.Certificate{cert},
+			ClientAuth: tls.RequireAnyClientCert},
+		&tls.Config{Certificates: []tls.Certificate{cert}, RootCAs: pool,
+			ServerName: "localhost"})
+
+	if err := (&ServerConfig{}).SetTLSExternal(&serverState, nil); err == nil {
+		t.Errorf("expected an error for an unverified client certificate")
+	}
+}
+
+// TestTLSExternalNoConnection refuses to derive the EXTERNAL identity without
+// a TLS connection.
+func TestTLSExternalNoConnection(t *testing.T) {
+	cert := NewTestCertificate(t)
+
+	if err := (&ServerConfig{}).SetTLSExternal(nil, nil); err == nil {
+		t.Errorf("expected an error for a server without a TLS connection")
+	}
+	if err := (&Config{}).SetTLSExternal(nil, cert.Leaf, nil); err == nil {
+		t.Errorf("expected an error for a client without a TLS connection")
+	}
+}
+
+// TestTLSExternalSSF maps cipher suites to the key length of their cipher.
+func TestTLSExternalSSF(t *testing.T) {
+	tests := []struct {
+		suite uint16
+		ssf   uint32
+	}{
+		{tls.TLS_AES_128_GCM_SHA256, 128},
+		{tls.TLS_CHACHA20_POLY1305_SHA256, 256},
+		{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, 256},
+		{tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA, 112},
+		{tls.TLS_FALLBACK_SCSV, 0},
+		{0xfeff, 0},
+	}
+	for _, test := range tests {
+		state := &tls.ConnectionState{CipherSuite: test.suite}
+		if ssf := TLSExternalSSF(state); ssf != test.ssf {
+			t.Errorf("expected SSF %d for %s, got %d", test.ssf,
+				tls.CipherSuiteName(test.suite), ssf)
+		}
+	}
+	if ssf := TLSExternalSSF(nil); ssf != 0 {
+		t.Errorf("expected SSF 0 without a connection, got %d", ssf)
+	}
+}
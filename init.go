@@ -0,0 +1,253 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdint.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// typedef struct SaslGlobal_struct {
+//     sasl_callback_t *sg_cbs;
+//     char *sg_appname;
+//     char *sg_plugin_path;
+//     char *sg_conf_path;
+//     uintptr_t sg_log_handle;
+// } SaslGlobal;
+//
+// void add_callback(sasl_callback_t* cbs, void *context, unsigned long id,
+//       int (*proc)(void));
+// extern int goVerifyFile(char *file, int type);
+// int cb_log(void *context, int level, const char *message);
+//
+// int cb_getpath(SaslGlobal *sg, const char **path) {
+//     *path = sg->sg_plugin_path;
+//     return SASL_OK;
+// }
+//
+// int cb_getconfpath(SaslGlobal *sg, char **path) {
+//     *path = sg->sg_conf_path;
+//     return SASL_OK;
+// }
+//
+// int cb_verifyfile(SaslGlobal *sg, const char *file,
+//       sasl_verify_type_t type) {
+//     return goVerifyFile((char *)file, (int)type);
+// }
+//
+// SaslGlobal* new_global(char *appname, char *plugin_path, char *conf_path,
+//       int verify, uintptr_t log_handle) {
+//     SaslGlobal *sg = (SaslGlobal *)malloc(sizeof(SaslGlobal));
+//     sasl_callback_t *cbs = (sasl_callback_t *)malloc(
+//           sizeof(sasl_callback_t)*5);
+//     int cbiter = 0;
+//
+//     memset(sg, 0, sizeof(SaslGlobal));
+//     sg->sg_appname     = appname;
+//     sg->sg_plugin_path = plugin_path;
+//     sg->sg_conf_path   = conf_path;
+//     sg->sg_log_handle  = log_handle;
+//
+//     if( sg->sg_plugin_path )
+//         add_callback(cbs + cbiter++, (void *)sg, SASL_CB_GETPATH,
+//           (int (*)(void))cb_getpath);
+//     if( sg->sg_conf_path )
+//         add_callback(cbs + cbiter++, (void *)sg, SASL_CB_GETCONFPATH,
+//           (int (*)(void))cb_getconfpath);
+//     if( verify )
+//         add_callback(cbs + cbiter++, (void *)sg, SASL_CB_VERIFYFILE,
+//           (int (*)(void))cb_verifyfile);
+//     if( sg->sg_log_handle )
+//         add_callback(cbs + cbiter++, (void *)sg->sg_log_handle, SASL_CB_LOG,
+//           (int (*)(void))cb_log);
+//     add_callback(cbs + cbiter++, (void *)sg, SASL_CB_LIST_END, NULL);
+//
+//     sg->sg_cbs = cbs;
+//     return sg;
+// }
+//
+// void free_global(SaslGlobal *sg) {
+//     if( !sg )
+//         return;
+//
+//     if( sg->sg_cbs )
+//         free(sg->sg_cbs);
+//     if( sg->sg_appname )
+//         free(sg->sg_appname);
+//     if( sg->sg_plugin_path )
+//         free(sg->sg_plugin_path);
+//     if( sg->sg_conf_path )
+//         free(sg->sg_conf_path);
+//
+//     free(sg);
+// }
+import "C"
+import (
+	"errors"
+	"log/slog"
+	"runtime/cgo"
+	"sync"
+)
+
+// DefaultAppName is the application name used when the library is
+// initialized implicitly or Options.AppName is empty. Cyrus uses it to find
+// the <appname>.conf configuration file.
+const DefaultAppName = "CyrusSASL"
+
+// ErrInitialized is returned by Init when the library has already been
+// initialized, either explicitly or by creating a Client or Server.
+var ErrInitialized = errors.New("sasl: library is already initialized")
+
+// Options controls the global initialization of libsasl2.
+type Options struct {
+	// AppName is passed to sasl_server_init. Defaults to DefaultAppName.
+	AppName string
+
+	// PluginPath is a colon separated list of directories searched for
+	// plugins. If empty, the libsasl2 default is used.
+	PluginPath string
+
+	// ConfPath is a colon separated list of directories searched for the
+	// <appname>.conf file. If empty, the libsasl2 default is used.
+	ConfPath string
+
+	// VerifyFile, if set, is called before libsasl2 loads a plugin or reads
+	// a configuration file. Returning an error makes libsasl2 skip the file.
+	VerifyFile func(file string, typ VerifyType) error
+
+	// Logger receives the messages logged by libsasl2 and its plugins. It
+	// can be overridden by Config.Logger and ServerConfig.Logger.
+	Logger *slog.Logger
+}
+
+// VerifyType is the kind of file passed to Options.VerifyFile.
+type VerifyType int
+
+// Kinds of files that libsasl2 asks to verify.
+const (
+	VerifyPlugin VerifyType = C.SASL_VRFY_PLUGIN
+	VerifyConf   VerifyType = C.SASL_VRFY_CONF
+	VerifyPasswd VerifyType = C.SASL_VRFY_PASSWD
+	VerifyOther  VerifyType = C.SASL_VRFY_OTHER
+)
+
+var (
+	globalMu sync.Mutex
+	global   *C.struct_SaslGlobal_struct
+
+	// globalLogHandle holds Options.Logger while the library is initialized.
+	globalLogHandle cgo.Handle
+
+	// verifyFile holds Options.VerifyFile while the library is initialized.
+	verifyFile func(file string, typ VerifyType) error
+)
+
+// Init initializes the client and server sides of libsasl2 with opts. It must
+// be called before any Client or Server is created; otherwise the library is
+// initialized with the default Options on first use and Init returns
+// ErrInitialized.
+func Init(opts Options) error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if global != nil {
+		return ErrInitialized
+	}
+	return initLocked(opts)
+}
+
+// Shutdown releases the resources held by libsasl2. All clients and servers
+// must be freed beforehand. Shutdown waits for aborted handshakes to return
+// from libsasl2. After Shutdown, the library may be initialized again.
+func Shutdown() error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if global == nil {
+		return nil
+	}
+	return shutdownLocked()
+}
+
+// shutdownLocked shuts down the initialized library. globalMu must be held.
+func shutdownLocked() error {
+	disposals.Wait()
+	clientRes := C.sasl_client_done()
+	serverRes := C.sasl_server_done()
+	C.free_global(global)
+	global = nil
+	verifyFile = nil
+	freeLogHandle(globalLogHandle)
+	globalLogHandle = 0
+
+	if clientRes != C.SASL_OK {
+		return newError(nil, clientRes, "Shutdown")
+	}
+	if serverRes != C.SASL_OK {
+		return newError(nil, serverRes, "Shutdown")
+	}
+	return nil
+}
+
+// initialize initializes the library with the default options unless it has
+// already been initialized.
+func initialize() error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	if global != nil {
+		return nil
+	}
+	return initLocked(Options{})
+}
+
+// initLocked starts the underlying sasl libraries so that plugins can be in
+// place before we create any clients or servers. globalMu must be held.
+func initLocked(opts Options) error {
+	if opts.AppName == "" {
+		opts.AppName = DefaultAppName
+	}
+
+	var pluginPathStr, confPathStr *C.char
+	appNameStr := C.CString(opts.AppName)
+	if len(opts.PluginPath) > 0 {
+		pluginPathStr = C.CString(opts.PluginPath)
+	}
+	if len(opts.ConfPath) > 0 {
+		confPathStr = C.CString(opts.ConfPath)
+	}
+	verify := C.int(0)
+	if opts.VerifyFile != nil {
+		verify = 1
+	}
+	verifyFile = opts.VerifyFile
+	logHandle := newLogHandle(opts.Logger)
+	sg := C.new_global(appNameStr, pluginPathStr, confPathStr, verify,
+		C.uintptr_t(logHandle))
+
+	res := C.sasl_client_init(sg.sg_cbs)
+	if res != C.SASL_OK {
+		C.free_global(sg)
+		verifyFile = nil
+		freeLogHandle(logHandle)
+		return newError(nil, res, "Init")
+	}
+
+	res = C.sasl_server_init(sg.sg_cbs, sg.sg_appname)
+	if res != C.SASL_OK {
+		C.sasl_client_done()
+		C.free_global(sg)
+		verifyFile = nil
+		freeLogHandle(logHandle)
+		return newError(nil, res, "Init")
+	}
+
+	global = sg
+	globalLogHandle = logHandle
+
+	if err := addRegistered(); err != nil {
+		shutdownLocked()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package sasl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInitShutdown tests explicit initialization and reinitialization.
+func TestInitShutdown(t *testing.T) {
+	if err := Shutdown(); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+
+	if err := Init(Options{AppName: "gosasltest"}); err != nil {
+		t.Fatalf("could not initialize: %v", err)
+	}
+	if err := Init(Options{}); !errors.Is(err, ErrInitialized) {
+		t.Errorf("expected ErrInitialized, got %v", err)
+	}
+	if err := Shutdown(); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+
+	// the library is initialized again lazily
+	cl := NewTestClient(t)
+	FreeTest(t, cl)
+}
+
+// TestInitPaths initializes the library against a temporary directory of
+// fixtures, so that no system plugins or configuration are used.
+func TestInitPaths(t *testing.T) {
+	dir := t.TempDir()
+	confFile := filepath.Join(dir, "gosasltest.conf")
+	if err := os.WriteFile(confFile, []byte("mech_list: PLAIN\n"), 0600); err != nil {
+		t.Fatalf("could not write config: %v", err)
+	}
+
+	verified := map[string]VerifyType{}
+	opts := Options{
+		AppName:    "gosasltest",
+		PluginPath: dir,
+		ConfPath:   dir,
+		VerifyFile: func(file string, typ VerifyType) error {
+			verified[file] = typ
+			return nil
+		},
+	}
+
+	if err := Shutdown(); err != nil {
+		t.Fatalf("could not shut down: %v", err)
+	}
+	if err := Init(opts); err != nil {
+		t.Fatalf("could not initialize: %v", err)
+	}
+	defer Shutdown()
+
+	if typ, ok := verified[confFile]; !ok || typ != VerifyConf {
+		t.Errorf("config file was not verified: %v", verified)
+	}
+
+	// there are no plugins in dir, so no mechanism can be negotiated.
+	cl := NewTestClient(t)
+	defer cl.Free()
+	if _, _, _, err := cl.Start([]string{"PLAIN"}); !errors.Is(err, ErrNoMech) {
+		t.Errorf("expected ErrNoMech, got %v", err)
+	}
+}
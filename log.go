@@ -0,0 +1,102 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdint.h>
+//
+// extern int goLog(uintptr_t handle, int level, char *message);
+//
+// int cb_log(void *context, int level, const char *message) {
+//     return goLog((uintptr_t)context, level, (char *)message);
+// }
+import "C"
+import (
+	"context"
+	"log/slog"
+	"runtime/cgo"
+	"strings"
+)
+
+// LevelTrace is the slog level used for SASL_LOG_TRACE messages.
+const LevelTrace = slog.LevelDebug - 4
+
+// redacted replaces secrets in log messages.
+const redacted = "[REDACTED]"
+
+// logLevels maps SASL_LOG_* levels to slog levels.
+var logLevels = map[C.int]slog.Level{
+	C.SASL_LOG_ERR:   slog.LevelError,
+	C.SASL_LOG_FAIL:  slog.LevelWarn,
+	C.SASL_LOG_WARN:  slog.LevelWarn,
+	C.SASL_LOG_NOTE:  slog.LevelInfo,
+	C.SASL_LOG_DEBUG: slog.LevelDebug,
+	C.SASL_LOG_TRACE: LevelTrace,
+	C.SASL_LOG_PASS:  LevelTrace,
+}
+
+// logLevelNames names the SASL_LOG_* levels for the "sasl_level" attribute.
+var logLevelNames = map[C.int]string{
+	C.SASL_LOG_ERR:   "err",
+	C.SASL_LOG_FAIL:  "fail",
+	C.SASL_LOG_WARN:  "warn",
+	C.SASL_LOG_NOTE:  "note",
+	C.SASL_LOG_DEBUG: "debug",
+	C.SASL_LOG_TRACE: "trace",
+	C.SASL_LOG_PASS:  "pass",
+}
+
+// saslLogger forwards libsasl2 log messages to a *slog.Logger, removing any
+// known secrets from the messages.
+type saslLogger struct {
+	logger  *slog.Logger
+	secrets []string
+}
+
+// newLogHandle creates a handle that can be passed to cb_log as its context.
+// It returns 0 if logger is nil. The handle must be released with
+// freeLogHandle.
+func newLogHandle(logger *slog.Logger, secrets ...string) cgo.Handle {
+	if logger == nil {
+		return 0
+	}
+
+	sl := &saslLogger{logger: logger}
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			sl.secrets = append(sl.secrets, secret)
+		}
+	}
+	return cgo.NewHandle(sl)
+}
+
+// freeLogHandle releases a handle created by newLogHandle.
+func freeLogHandle(h cgo.Handle) {
+	if h != 0 {
+		h.Delete()
+	}
+}
+
+// log writes a single libsasl2 message. SASL_LOG_PASS messages may contain
+// passwords, so their text is never forwarded.
+func (sl *saslLogger) log(level C.int, msg string) {
+	slogLevel, ok := logLevels[level]
+	if !ok {
+		slogLevel = slog.LevelInfo
+	}
+
+	ctx := context.Background()
+	if !sl.logger.Enabled(ctx, slogLevel) {
+		return
+	}
+
+	if level == C.SASL_LOG_PASS {
+		msg = redacted
+	}
+	for _, secret := range sl.secrets {
+		msg = strings.ReplaceAll(msg, secret, redacted)
+	}
+
+	sl.logger.Log(ctx, slogLevel, msg,
+		slog.String("sasl_level", logLevelNames[level]))
+}
@@ -0,0 +1,46 @@
+package sasl
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestLogRedaction checks that passwords never reach the logger.
+func TestLogRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf,
+		&slog.HandlerOptions{Level: LevelTrace}))
+
+	sl := &saslLogger{logger: logger, secrets: []string{"hunter2"}}
+	sl.log(5, "checking password hunter2 for user") // SASL_LOG_DEBUG
+	sl.log(7, "plaintext password is secret")       // SASL_LOG_PASS
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "secret") {
+		t.Errorf("secret leaked into log output:\n%v", out)
+	}
+	if !strings.Contains(out, "sasl_level=debug") ||
+		!strings.Contains(out, "sasl_level=pass") {
+		t.Errorf("missing sasl levels in log output:\n%v", out)
+	}
+}
+
+// TestServerLogger checks that libsasl2 messages are forwarded to the logger.
+func TestServerLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf,
+		&slog.HandlerOptions{Level: LevelTrace}))
+
+	ss := NewTestServer(t, &ServerConfig{Logger: logger})
+	defer ss.Free()
+
+	// an unknown mechanism is logged by libsasl2.
+	if _, _, err := ss.Start("NOT-A-MECH", nil); err == nil {
+		t.Fatalf("expected an error for an unknown mechanism")
+	}
+	if buf.Len() == 0 {
+		t.Errorf("no messages were logged")
+	}
+}
@@ -0,0 +1,324 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/saslplug.h>
+// #include <stdint.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// extern void goMechanismInfo(uintptr_t handle, char *name, char *plugin,
+//       unsigned max_ssf, unsigned security_flags, unsigned features);
+//
+// void cb_client_plugin_info(client_sasl_mechanism_t *m,
+//       sasl_info_callback_stage_t stage, void *rock) {
+//     if( stage != SASL_INFO_LIST_MECH || !m || !m->plug )
+//         return;
+//     goMechanismInfo((uintptr_t)rock, (char *)m->plug->mech_name,
+//           m->plugname, m->plug->max_ssf, m->plug->security_flags,
+//           m->plug->features);
+// }
+//
+// void cb_server_plugin_info(server_sasl_mechanism_t *m,
+//       sasl_info_callback_stage_t stage, void *rock) {
+//     if( stage != SASL_INFO_LIST_MECH || !m || !m->plug )
+//         return;
+//     goMechanismInfo((uintptr_t)rock, (char *)m->plug->mech_name,
+//           m->plugname, m->plug->max_ssf, m->plug->security_flags,
+//           m->plug->features);
+// }
+//
+// int client_plugin_info(char *mech_list, uintptr_t handle) {
+//     return sasl_client_plugin_info(mech_list, cb_client_plugin_info,
+//           (void *)handle);
+// }
+//
+// int server_plugin_info(char *mech_list, uintptr_t handle) {
+//     return sasl_server_plugin_info(mech_list, cb_server_plugin_info,
+//           (void *)handle);
+// }
+//
+// extern int goClientMechNew(char *name, sasl_client_params_t *cparams,
+//       uintptr_t *handle);
+// extern int goClientMechStep(uintptr_t handle,
+//       sasl_client_params_t *cparams, char *serverin, unsigned serverinlen,
+//       char **clientout, unsigned *clientoutlen, sasl_out_params_t *oparams);
+// extern int goServerMechNew(char *name, sasl_server_params_t *sparams,
+//       uintptr_t *handle);
+// extern int goServerMechStep(uintptr_t handle,
+//       sasl_server_params_t *sparams, char *clientin, unsigned clientinlen,
+//       char **serverout, unsigned *serveroutlen, sasl_out_params_t *oparams);
+// extern void goMechDispose(uintptr_t handle);
+//
+// typedef struct GoMech_struct {
+//     union {
+//         sasl_client_plug_t client;
+//         sasl_server_plug_t server;
+//     } gm_plug;
+//     char *gm_name;
+// } GoMech;
+//
+// // added_mech is the plug returned by the next call to gomech_client_init
+// // or gomech_server_init, the add_plugin functions do not pass a context.
+// GoMech *added_mech;
+//
+// int gomech_client_new(void *glob_context, sasl_client_params_t *cparams,
+//       void **conn_context) {
+//     GoMech *gm = (GoMech *)glob_context;
+//     uintptr_t handle = 0;
+//     int res = goClientMechNew(gm->gm_name, cparams, &handle);
+//     *conn_context = (void *)handle;
+//     return res;
+// }
+//
+// int gomech_server_new(void *glob_context, sasl_server_params_t *sparams,
+//       const char *challenge, unsigned challen, void **conn_context) {
+//     GoMech *gm = (GoMech *)glob_context;
+//     uintptr_t handle = 0;
+//     int res = goServerMechNew(gm->gm_name, sparams, &handle);
+//     *conn_context = (void *)handle;
+//     return res;
+// }
+//
+// int gomech_client_step(void *conn_context, sasl_client_params_t *cparams,
+//       const char *serverin, unsigned serverinlen,
+//       sasl_interact_t **prompt_need, const char **clientout,
+//       unsigned *clientoutlen, sasl_out_params_t *oparams) {
+//     return goClientMechStep((uintptr_t)conn_context, cparams,
+//           (char *)serverin, serverinlen, (char **)clientout, clientoutlen,
+//           oparams);
+// }
+//
+// int gomech_server_step(void *conn_context, sasl_server_params_t *sparams,
+//       const char *clientin, unsigned clientinlen, const char **serverout,
+//       unsigned *serveroutlen, sasl_out_params_t *oparams) {
+//     return goServerMechStep((uintptr_t)conn_context, sparams,
+//           (char *)clientin, clientinlen, (char **)serverout, serveroutlen,
+//           oparams);
+// }
+//
+// void gomech_dispose(void *conn_context, const sasl_utils_t *utils) {
+//     goMechDispose((uintptr_t)conn_context);
+// }
+//
+// void gomech_free(void *glob_context, const sasl_utils_t *utils) {
+//     GoMech *gm = (GoMech *)glob_context;
+//     free(gm->gm_name);
+//     free(gm);
+// }
+//
+// int gomech_client_init(const sasl_utils_t *utils, int max_version,
+//       int *out_version, sasl_client_plug_t **pluglist, int *plugcount) {
+//     if( max_version < SASL_CLIENT_PLUG_VERSION || !added_mech )
+//         return SASL_BADVERS;
+//
+//     *out_version = SASL_CLIENT_PLUG_VERSION;
+//     *pluglist = &added_mech->gm_plug.client;
+//     *plugcount = 1;
+//     added_mech = NULL;
+//     return SASL_OK;
+// }
+//
+// int gomech_server_init(const sasl_utils_t *utils, int max_version,
+//       int *out_version, sasl_server_plug_t **pluglist, int *plugcount) {
+//     if( max_version < SASL_SERVER_PLUG_VERSION || !added_mech )
+//         return SASL_BADVERS;
+//
+//     *out_version = SASL_SERVER_PLUG_VERSION;
+//     *pluglist = &added_mech->gm_plug.server;
+//     *plugcount = 1;
+//     added_mech = NULL;
+//     return SASL_OK;
+// }
+//
+// int add_mech(int server, char *name, char *plugin, unsigned security_flags,
+//       unsigned features) {
+//     int res;
+//     GoMech *gm = (GoMech *)malloc(sizeof(GoMech));
+//     if( !gm )
+//         return SASL_NOMEM;
+//
+//     memset(gm, 0, sizeof(GoMech));
+//     gm->gm_name = strdup(name);
+//     added_mech = gm;
+//     if( server ) {
+//         sasl_server_plug_t *plug = &gm->gm_plug.server;
+//         plug->mech_name      = gm->gm_name;
+//         plug->security_flags = security_flags;
+//         plug->features       = features;
+//         plug->glob_context   = gm;
+//         plug->mech_new       = gomech_server_new;
+//         plug->mech_step      = gomech_server_step;
+//         plug->mech_dispose   = gomech_dispose;
+//         plug->mech_free      = gomech_free;
+//         res = sasl_server_add_plugin(plugin, gomech_server_init);
+//     } else {
+//         sasl_client_plug_t *plug = &gm->gm_plug.client;
+//         plug->mech_name      = gm->gm_name;
+//         plug->security_flags = security_flags;
+//         plug->features       = features;
+//         plug->glob_context   = gm;
+//         plug->mech_new       = gomech_client_new;
+//         plug->mech_step      = gomech_client_step;
+//         plug->mech_dispose   = gomech_dispose;
+//         plug->mech_free      = gomech_free;
+//         res = sasl_client_add_plugin(plugin, gomech_client_init);
+//     }
+//     // once initialized, the plug is freed by sasl_client_done or
+//     // sasl_server_done
+//     if( added_mech ) {
+//         added_mech = NULL;
+//         gomech_free(gm, NULL);
+//     }
+//     return res;
+// }
+import "C"
+import (
+	"runtime/cgo"
+	"slices"
+	"strings"
+	"unsafe"
+)
+
+// SecurityFlags are the SASL_SEC_* properties of a mechanism.
+type SecurityFlags uint
+
+// Security properties a mechanism may provide.
+const (
+	SecNoPlaintext     SecurityFlags = C.SASL_SEC_NOPLAINTEXT
+	SecNoActive        SecurityFlags = C.SASL_SEC_NOACTIVE
+	SecNoDictionary    SecurityFlags = C.SASL_SEC_NODICTIONARY
+	SecForwardSecrecy  SecurityFlags = C.SASL_SEC_FORWARD_SECRECY
+	SecNoAnonymous     SecurityFlags = C.SASL_SEC_NOANONYMOUS
+	SecPassCredentials SecurityFlags = C.SASL_SEC_PASS_CREDENTIALS
+	SecMutualAuth      SecurityFlags = C.SASL_SEC_MUTUAL_AUTH
+)
+
+// Features are the SASL_FEAT_* features of a mechanism.
+type Features uint
+
+// Features a mechanism may support.
+const (
+	FeatNeedServerFQDN    Features = C.SASL_FEAT_NEEDSERVERFQDN
+	FeatWantClientFirst   Features = C.SASL_FEAT_WANT_CLIENT_FIRST
+	FeatServerFirst       Features = C.SASL_FEAT_SERVER_FIRST
+	FeatAllowsProxy       Features = C.SASL_FEAT_ALLOWS_PROXY
+	FeatDontUseUserPasswd Features = C.SASL_FEAT_DONTUSE_USERPASSWD
+	FeatGSSFraming        Features = C.SASL_FEAT_GSS_FRAMING
+	FeatChannelBinding    Features = C.SASL_FEAT_CHANNEL_BINDING
+	FeatSupportsHTTP      Features = C.SASL_FEAT_SUPPORTS_HTTP
+)
+
+// MechanismInfo describes a mechanism provided by an installed plugin.
+type MechanismInfo struct {
+	Name          string
+	Plugin        string
+	MaxSSF        uint
+	SecurityFlags SecurityFlags
+	Features      Features
+}
+
+// Has reports whether the mechanism provides all of the security flags in f.
+func (f SecurityFlags) Has(flags SecurityFlags) bool {
+	return f&flags == flags
+}
+
+// Has reports whether the mechanism supports all of the features in f.
+func (f Features) Has(features Features) bool {
+	return f&features == features
+}
+
+// ListClientMechanisms lists the mechanisms that the installed plugins can
+// negotiate as a client.
+func ListClientMechanisms() ([]MechanismInfo, error) {
+	return listMechanisms(func(mechList *C.char, h C.uintptr_t) C.int {
+		return C.client_plugin_info(mechList, h)
+	}, clientMechs.names())
+}
+
+// ListServerMechanisms lists the mechanisms that the installed plugins can
+// negotiate as a server.
+func ListServerMechanisms() ([]MechanismInfo, error) {
+	return listMechanisms(func(mechList *C.char, h C.uintptr_t) C.int {
+		return C.server_plugin_info(mechList, h)
+	}, serverMechs.names())
+}
+
+// listMechanisms collects the plugin information for every mechanism known
+// to sasl_global_listmech and the mechanisms registered in Go, which it does
+// not know as they are added after initialization.
+func listMechanisms(pluginInfo func(*C.char, C.uintptr_t) C.int,
+	registered []string) ([]MechanismInfo, error) {
+	if err := initialize(); err != nil {
+		return nil, err
+	}
+
+	names := globalMechanisms()
+	for _, name := range registered {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var infos []MechanismInfo
+	h := cgo.NewHandle(&infos)
+	defer h.Delete()
+
+	mechListStr := C.CString(strings.Join(names, " "))
+	defer C.free(unsafe.Pointer(mechListStr))
+
+	res := pluginInfo(mechListStr, C.uintptr_t(h))
+	if res != C.SASL_OK {
+		return nil, newError(nil, res, "ListMechanisms")
+	}
+	return infos, nil
+}
+
+// globalMechanisms returns the names of all the mechanisms that are loaded.
+func globalMechanisms() []string {
+	return goStrings(C.sasl_global_listmech())
+}
+
+// registeredMech is a mechanism passed to RegisterClientMechanism or
+// RegisterServerMechanism.
+type registeredMech[M any] struct {
+	info MechanismInfo
+	mech M
+}
+
+// addMech returns the add function of a registry of mechanisms, which adds
+// them as client or server plugins.
+func addMech[M any](server bool) func(string, registeredMech[M]) C.int {
+	isServer := C.int(0)
+	if server {
+		isServer = 1
+	}
+	return func(_ string, m registeredMech[M]) C.int {
+		nameStr := C.CString(m.info.Name)
+		defer C.free(unsafe.Pointer(nameStr))
+		pluginStr := C.CString(m.info.Plugin)
+		defer C.free(unsafe.Pointer(pluginStr))
+
+		return C.add_mech(isServer, nameStr, pluginStr,
+			C.uint(m.info.SecurityFlags), C.uint(m.info.Features))
+	}
+}
+
+// mechExchange is the connection context of a mechanism registered in Go.
+type mechExchange interface {
+	// dispose frees the C memory held by the exchange.
+	dispose()
+}
+
+// mechDispose frees the exchange of handle.
+func mechDispose(handle cgo.Handle) {
+	if handle == 0 {
+		return
+	}
+	handle.Value().(mechExchange).dispose()
+	handle.Delete()
+}
@@ -0,0 +1,25 @@
+package sasl
+
+import "testing"
+
+// TestListClientMechanisms checks the plugin information of PLAIN.
+func TestListClientMechanisms(t *testing.T) {
+	mechs, err := ListClientMechanisms()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+
+	for _, mech := range mechs {
+		if mech.Name != "PLAIN" {
+			continue
+		}
+		if !mech.Features.Has(FeatWantClientFirst) {
+			t.Errorf("PLAIN should want the client to go first: %+v", mech)
+		}
+		if mech.MaxSSF != 0 {
+			t.Errorf("PLAIN should not have a security layer: %+v", mech)
+		}
+		return
+	}
+	t.Skipf("PLAIN plugin is not installed: %+v", mechs)
+}
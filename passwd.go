@@ -0,0 +1,135 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdlib.h>
+import "C"
+import (
+	"context"
+	"unsafe"
+)
+
+// SetPassFlags control SetPassword.
+type SetPassFlags uint
+
+// Flags of SetPassword.
+const (
+	// SetPassCreate creates the user if it does not exist. Backends such as
+	// sasldb create missing users regardless.
+	SetPassCreate SetPassFlags = C.SASL_SET_CREATE
+	// SetPassDisable disables the account instead of setting a password.
+	// sasldb removes the user instead.
+	SetPassDisable SetPassFlags = C.SASL_SET_DISABLE
+	// SetPassNoPlain only stores the secrets of mechanisms that do not
+	// need the plaintext password.
+	SetPassNoPlain SetPassFlags = C.SASL_SET_NOPLAIN
+	// SetPassCurMechOnly only stores the secret of the negotiated
+	// mechanism.
+	SetPassCurMechOnly SetPassFlags = C.SASL_SET_CURMECH_ONLY
+)
+
+// SetPassword sets the password of user in the password backends of the
+// server, e.g. the sasldb selected with the "sasldb_path" option. oldPass
+// is only checked by backends that need it.
+func (ss *Server) SetPassword(user, oldPass, newPass string,
+	flags SetPassFlags) error {
+	userStr := C.CString(user)
+	defer C.free(unsafe.Pointer(userStr))
+	var oldPassStr, newPassStr *C.char
+	if oldPass != "" {
+		oldPassStr = C.CString(oldPass)
+		defer C.free(unsafe.Pointer(oldPassStr))
+	}
+	if newPass != "" {
+		newPassStr = C.CString(newPass)
+		defer C.free(unsafe.Pointer(newPassStr))
+	}
+
+	conn, err := ss.lock("SetPassword")
+	if err != nil {
+		return err
+	}
+	defer ss.mu.Unlock()
+
+	var res C.int
+	err = ss.run(context.Background(), "SetPassword",
+		func(conn *C.struct_sasl_conn) {
+			res = C.sasl_setpass(conn, userStr, newPassStr,
+				C.uint(len(newPass)), oldPassStr, C.uint(len(oldPass)),
+				C.uint(flags))
+		})
+	if err != nil {
+		return err
+	}
+	if res != C.SASL_OK {
+		return newError(conn, res, "SetPassword")
+	}
+	return nil
+}
+
+// UserExists reports whether user has an account with the service of the
+// server.
+func (ss *Server) UserExists(user string) (bool, error) {
+	userStr := C.CString(user)
+	defer C.free(unsafe.Pointer(userStr))
+
+	conn, err := ss.lock("UserExists")
+	if err != nil {
+		return false, err
+	}
+	defer ss.mu.Unlock()
+
+	var res C.int
+	err = ss.run(context.Background(), "UserExists",
+		func(conn *C.struct_sasl_conn) {
+			res = C.sasl_user_exists(conn, nil, nil, userStr)
+		})
+	if err != nil {
+		return false, err
+	}
+	switch res {
+	case C.SASL_OK:
+		return true, nil
+	case C.SASL_NOUSER:
+		return false, nil
+	}
+	return false, newError(conn, res, "UserExists")
+}
+
+// CheckPassword checks pass against the stored password of user. It fails
+// with ErrBadAuth for a wrong password or a missing user, lest the error
+// reveal which users exist, and with ErrDisabled for an account its backend
+// reports as disabled. Callers that need to tell a missing user apart can
+// call UserExists.
+func (ss *Server) CheckPassword(user, pass string) error {
+	userStr := C.CString(user)
+	defer C.free(unsafe.Pointer(userStr))
+	passStr := C.CString(pass)
+	defer C.free(unsafe.Pointer(passStr))
+
+	conn, err := ss.lock("CheckPassword")
+	if err != nil {
+		return err
+	}
+	defer ss.mu.Unlock()
+
+	var res C.int
+	err = ss.run(context.Background(), "CheckPassword",
+		func(conn *C.struct_sasl_conn) {
+			res = C.sasl_checkpass(conn, userStr, C.uint(len(user)),
+				passStr, C.uint(len(pass)))
+		})
+	if err != nil {
+		return err
+	}
+	// some pwcheck methods of libsasl2 fail with SASL_NOUSER, whose detail
+	// names the missing user too
+	if res == C.SASL_NOUSER {
+		return newError(nil, C.SASL_BADAUTH, "CheckPassword")
+	}
+	if res != C.SASL_OK {
+		return newError(conn, res, "CheckPassword")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package sasl
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// NewSasldbServer creates a server that keeps its users in a temporary
+// sasldb.
+func NewSasldbServer(t *testing.T) *Server {
+	return NewTestServer(t, &ServerConfig{
+		Options: map[string]string{
+			"sasldb_path":    filepath.Join(t.TempDir(), "sasldb2"),
+			"auxprop_plugin": "sasldb",
+			"pwcheck_method": "auxprop",
+		},
+	})
+}
+
+// TestPasswords manages a user and checks its password.
+func TestPasswords(t *testing.T) {
+	ss := NewSasldbServer(t)
+	defer ss.Free()
+
+	if exists, err := ss.UserExists("alice"); err != nil || exists {
+		t.Errorf("expected no alice, got %v, %v", exists, err)
+	}
+	if err := ss.SetPassword("alice", "", "secret", SetPassCreate); err != nil {
+		t.Fatalf("could not create alice: %v", err)
+	}
+	if exists, err := ss.UserExists("alice"); err != nil || !exists {
+		t.Errorf("expected alice, got %v, %v", exists, err)
+	}
+
+	if err := ss.CheckPassword("alice", "secret"); err != nil {
+		t.Errorf("expected the password to match: %v", err)
+	}
+	if err := ss.CheckPassword("alice", "wrong"); !errors.Is(err,
+		ErrBadAuth) {
+		t.Errorf("expected ErrBadAuth, got %v", err)
+	}
+	if err := ss.CheckPassword("bob", "secret"); !errors.Is(err,
+		ErrBadAuth) {
+		t.Errorf("expected ErrBadAuth, got %v", err)
+	}
+
+	if err := ss.SetPassword("alice", "secret", "changed", 0); err != nil {
+		t.Fatalf("could not change the password: %v", err)
+	}
+	if err := ss.CheckPassword("alice", "changed"); err != nil {
+		t.Errorf("expected the new password to match: %v", err)
+	}
+
+	if err := ss.SetPassword("alice", "", "", SetPassDisable); err != nil {
+		t.Fatalf("could not disable alice: %v", err)
+	}
+	// sasldb removes disabled users
+	if err := ss.CheckPassword("alice", "changed"); !errors.Is(err,
+		ErrBadAuth) {
+		t.Errorf("expected ErrBadAuth, got %v", err)
+	}
+	if exists, err := ss.UserExists("alice"); err != nil || exists {
+		t.Errorf("expected no alice, got %v, %v", exists, err)
+	}
+}
+
+// TestCheckPasswordDisabled checks the password of a disabled account in a
+// UserStore.
+func TestCheckPasswordDisabled(t *testing.T) {
+	ss := NewMechServer(t, nil)
+	defer ss.Free()
+
+	if err := ss.CheckPassword("carol", "secret"); !errors.Is(err,
+		ErrDisabled) {
+		t.Errorf("expected ErrDisabled, got %v", err)
+	}
+	if err := ss.CheckPassword("alice", "wrong"); !errors.Is(err,
+		ErrBadAuth) {
+		t.Errorf("expected ErrBadAuth, got %v", err)
+	}
+}
+
+// TestPasswordsFreed checks that a freed server cannot manage users.
+func TestPasswordsFreed(t *testing.T) {
+	ss := NewSasldbServer(t)
+	ss.Free()
+
+	if _, err := ss.UserExists("alice"); !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
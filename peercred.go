@@ -0,0 +1,68 @@
+package sasl
+
+import (
+	"net"
+	"os/user"
+	"strconv"
+)
+
+// PeerCred holds the credentials of the process on the other end of a Unix
+// domain socket.
+type PeerCred struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// PeerIdentityFunc maps the credentials of a peer to the identity used for
+// EXTERNAL authentication (SASL_AUTH_EXTERNAL).
+type PeerIdentityFunc func(cred *PeerCred) (string, error)
+
+// LocalUser is a PeerIdentityFunc that uses the name of the local user with
+// the peer's UID.
+func LocalUser(cred *PeerCred) (string, error) {
+	u, err := user.LookupId(strconv.FormatUint(uint64(cred.UID), 10))
+	if err != nil {
+		return "", err
+	}
+	return u.Username, nil
+}
+
+// SetExternal sets the identity and security strength factor of an
+// authentication that took place outside of SASL, so that the EXTERNAL
+// mechanism can be used. It must be called before Start.
+func (ss *Server) SetExternal(username string, ssf uint32) error {
+	conn, err := ss.lock("SetExternal", StateNew)
+	if err != nil {
+		return err
+	}
+	defer ss.mu.Unlock()
+
+	if err := setExternal(conn, username, ssf); err != nil {
+		return err
+	}
+	ss.externalSSF = ssf
+	return nil
+}
+
+// SetUnixExternal reads the credentials of the peer of conn, maps them to an
+// identity and sets it as the external identity of the server with the
+// given ssf. If identity is nil, LocalUser is used. A Unix domain socket
+// provides no encryption, so ssf is usually 0 unless the socket is only
+// reachable by trusted processes.
+func (ss *Server) SetUnixExternal(conn *net.UnixConn, identity PeerIdentityFunc,
+	ssf uint32) error {
+	if identity == nil {
+		identity = LocalUser
+	}
+
+	cred, err := GetPeerCred(conn)
+	if err != nil {
+		return err
+	}
+	username, err := identity(cred)
+	if err != nil {
+		return err
+	}
+	return ss.SetExternal(username, ssf)
+}
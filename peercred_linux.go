@@ -0,0 +1,31 @@
+//go:build linux
+
+package sasl
+
+import (
+	"net"
+	"syscall"
+)
+
+// GetPeerCred reads the credentials of the peer of conn with SO_PEERCRED.
+func GetPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	var ucred *syscall.Ucred
+	var credErr error
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET,
+			syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if credErr != nil {
+		return nil, credErr
+	}
+
+	return &PeerCred{PID: ucred.Pid, UID: ucred.Uid, GID: ucred.Gid}, nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package sasl
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// UnixLoopback connects to a Unix domain socket in a temporary directory and
+// returns the server side of the connection.
+func UnixLoopback(t *testing.T) (client, server *net.UnixConn) {
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "sasl.sock"),
+		Net: "unix"}
+	l, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+
+	client, err = net.DialUnix("unix", nil, addr)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	server, err = l.AcceptUnix()
+	if err != nil {
+		t.Fatalf("could not accept: %v", err)
+	}
+	return client, server
+}
+
+// TestUnixExternal sets the external identity of a server from the peer
+// credentials of a Unix domain socket.
+func TestUnixExternal(t *testing.T) {
+	client, server := UnixLoopback(t)
+	defer client.Close()
+	defer server.Close()
+
+	cred, err := GetPeerCred(server)
+	if err != nil {
+		t.Fatalf("could not get peer credentials: %v", err)
+	}
+	if cred.UID != uint32(os.Getuid()) || cred.PID != int32(os.Getpid()) {
+		t.Errorf("unexpected peer credentials: %+v", cred)
+	}
+
+	ss := NewTestServer(t, nil)
+	defer ss.Free()
+
+	uid := func(cred *PeerCred) (string, error) {
+		return fmt.Sprintf("uid=%d", cred.UID), nil
+	}
+	if err := ss.SetUnixExternal(server, uid, 0); err != nil {
+		t.Fatalf("could not set external: %v", err)
+	}
+
+	mechs, err := ss.ListMech()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+	for _, mech := range mechs {
+		if mech == "EXTERNAL" {
+			return
+		}
+	}
+	t.Errorf("EXTERNAL is not offered: %v", mechs)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package sasl
+
+import (
+	"errors"
+	"net"
+)
+
+// GetPeerCred reads the credentials of the peer of conn. It is only
+// supported on Linux.
+func GetPeerCred(conn *net.UnixConn) (*PeerCred, error) {
+	return nil, errors.New("sasl: peer credentials are not supported on " +
+		"this platform")
+}
@@ -0,0 +1,104 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <stdlib.h>
+// #include <string.h>
+import "C"
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+// PromptID identifies the information requested by a Prompt.
+type PromptID int
+
+// Kinds of information a mechanism may ask for during the handshake.
+const (
+	PromptUser         PromptID = C.SASL_CB_USER
+	PromptAuthname     PromptID = C.SASL_CB_AUTHNAME
+	PromptLanguage     PromptID = C.SASL_CB_LANGUAGE
+	PromptPass         PromptID = C.SASL_CB_PASS
+	PromptEchoPrompt   PromptID = C.SASL_CB_ECHOPROMPT
+	PromptNoEchoPrompt PromptID = C.SASL_CB_NOECHOPROMPT
+	PromptCnonce       PromptID = C.SASL_CB_CNONCE
+	PromptRealm        PromptID = C.SASL_CB_GETREALM
+)
+
+// Prompt is a request for information that is not available through the
+// Config, such as a one time password (a sasl_interact_t).
+type Prompt struct {
+	ID        PromptID
+	Challenge string
+	Text      string
+	Default   string
+}
+
+// PromptFunc answers a Prompt. ctx is the context passed to StartContext or
+// StepContext, and should be used to abandon prompts that may block. The
+// client may be freed meanwhile, see Client.
+type PromptFunc func(ctx context.Context, p Prompt) (string, error)
+
+// doPrompt answers the SASL_CB_LIST_END terminated list of prompts with fn.
+// If fn is nil, the user is asked on stdin. libsasl2 does not copy the
+// results, so they are returned, also on error, for the caller to free once
+// the mechanism is done with them.
+func doPrompt(ctx context.Context, fn PromptFunc,
+	prompts *C.sasl_interact_t) ([]*C.char, error) {
+	if fn == nil {
+		fn = stdinPrompt
+	}
+
+	var results []*C.char
+	for p := prompts; p.id != C.SASL_CB_LIST_END; p = nextPrompt(p) {
+		response, err := fn(ctx, Prompt{
+			ID:        PromptID(p.id),
+			Challenge: C.GoString(p.challenge),
+			Text:      C.GoString(p.prompt),
+			Default:   C.GoString(p.defresult),
+		})
+		if err != nil {
+			return results, err
+		}
+
+		result := C.CString(response)
+		results = append(results, result)
+		p.result = unsafe.Pointer(result)
+		p.len = C.uint(len(response))
+	}
+	return results, nil
+}
+
+// nextPrompt returns the prompt following p.
+func nextPrompt(p *C.sasl_interact_t) *C.sasl_interact_t {
+	return (*C.sasl_interact_t)(unsafe.Add(unsafe.Pointer(p),
+		unsafe.Sizeof(*p)))
+}
+
+// stdinPrompt takes user input from stdin. If reading fails (i.e. if stdin
+// is closed), then the default result will be used.
+func stdinPrompt(ctx context.Context, p Prompt) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	if len(p.Default) == 0 {
+		fmt.Printf("%s: ", p.Text)
+	} else {
+		fmt.Printf("%s [%s]: ", p.Text, p.Default)
+	}
+
+	response, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	response = strings.Trim(response, "\n")
+
+	// if there is an error, then use the default.
+	if err != nil {
+		return p.Default, nil
+	}
+	return response, nil
+}
@@ -0,0 +1,228 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+
+// GetAuthUser gets the authentication identity (SASL_AUTHUSER). It differs
+// from GetUsername when an authorization identity was requested.
+func (cl *Client) GetAuthUser() (string, error) {
+	return cl.getString(C.SASL_AUTHUSER)
+}
+
+// GetDefUserRealm gets the default realm of the user (SASL_DEFUSERREALM).
+func (cl *Client) GetDefUserRealm() (string, error) {
+	return cl.getString(C.SASL_DEFUSERREALM)
+}
+
+// SetDefUserRealm sets the default realm of the user (SASL_DEFUSERREALM).
+func (cl *Client) SetDefUserRealm(realm string) error {
+	return cl.setString(C.SASL_DEFUSERREALM, realm)
+}
+
+// GetMechName gets the name of the negotiated mechanism (SASL_MECHNAME).
+func (cl *Client) GetMechName() (string, error) {
+	return cl.getString(C.SASL_MECHNAME)
+}
+
+// GetMaxOutBuf gets the largest buffer that may be passed to Encode
+// (SASL_MAXOUTBUF).
+func (cl *Client) GetMaxOutBuf() (uint, error) {
+	return cl.getUint(C.SASL_MAXOUTBUF)
+}
+
+// GetService gets the service name the client was created with
+// (SASL_SERVICE).
+func (cl *Client) GetService() (string, error) {
+	return cl.getString(C.SASL_SERVICE)
+}
+
+// GetServerFQDN gets the host name of the server (SASL_SERVERFQDN).
+func (cl *Client) GetServerFQDN() (string, error) {
+	return cl.getString(C.SASL_SERVERFQDN)
+}
+
+// GetIPLocalPort gets the local address in "a.b.c.d;port" form
+// (SASL_IPLOCALPORT).
+func (cl *Client) GetIPLocalPort() (string, error) {
+	return cl.getString(C.SASL_IPLOCALPORT)
+}
+
+// SetIPLocalPort sets the local address in "a.b.c.d;port" form
+// (SASL_IPLOCALPORT).
+func (cl *Client) SetIPLocalPort(addr string) error {
+	return cl.setString(C.SASL_IPLOCALPORT, addr)
+}
+
+// GetIPRemotePort gets the remote address in "a.b.c.d;port" form
+// (SASL_IPREMOTEPORT).
+func (cl *Client) GetIPRemotePort() (string, error) {
+	return cl.getString(C.SASL_IPREMOTEPORT)
+}
+
+// SetIPRemotePort sets the remote address in "a.b.c.d;port" form
+// (SASL_IPREMOTEPORT).
+func (cl *Client) SetIPRemotePort(addr string) error {
+	return cl.setString(C.SASL_IPREMOTEPORT, addr)
+}
+
+// GetAppName gets the application name passed to Init (SASL_APPNAME).
+func (cl *Client) GetAppName() (string, error) {
+	return cl.getString(C.SASL_APPNAME)
+}
+
+// GetGSSPeerName gets the GSS-API name of the server (SASL_GSS_PEER_NAME).
+func (cl *Client) GetGSSPeerName() (string, error) {
+	return cl.getString(C.SASL_GSS_PEER_NAME)
+}
+
+// GetAuthSource gets the name of the source that authenticated the user
+// (SASL_AUTHSOURCE).
+func (cl *Client) GetAuthSource() (string, error) {
+	return cl.getString(C.SASL_AUTHSOURCE)
+}
+
+// GetAuthUser gets the authentication identity (SASL_AUTHUSER). It differs
+// from GetUsername when the client requested an authorization identity.
+func (ss *Server) GetAuthUser() (string, error) {
+	return ss.getString(C.SASL_AUTHUSER)
+}
+
+// GetDefUserRealm gets the default realm of users (SASL_DEFUSERREALM).
+func (ss *Server) GetDefUserRealm() (string, error) {
+	return ss.getString(C.SASL_DEFUSERREALM)
+}
+
+// SetDefUserRealm sets the default realm of users (SASL_DEFUSERREALM).
+func (ss *Server) SetDefUserRealm(realm string) error {
+	return ss.setString(C.SASL_DEFUSERREALM, realm)
+}
+
+// GetMechName gets the name of the negotiated mechanism (SASL_MECHNAME).
+func (ss *Server) GetMechName() (string, error) {
+	return ss.getString(C.SASL_MECHNAME)
+}
+
+// GetMaxOutBuf gets the largest buffer that may be passed to Encode
+// (SASL_MAXOUTBUF).
+func (ss *Server) GetMaxOutBuf() (uint, error) {
+	return ss.getUint(C.SASL_MAXOUTBUF)
+}
+
+// GetService gets the service name the server was created with
+// (SASL_SERVICE).
+func (ss *Server) GetService() (string, error) {
+	return ss.getString(C.SASL_SERVICE)
+}
+
+// GetServerFQDN gets the host name of the server (SASL_SERVERFQDN).
+func (ss *Server) GetServerFQDN() (string, error) {
+	return ss.getString(C.SASL_SERVERFQDN)
+}
+
+// GetIPLocalPort gets the local address in "a.b.c.d;port" form
+// (SASL_IPLOCALPORT).
+func (ss *Server) GetIPLocalPort() (string, error) {
+	return ss.getString(C.SASL_IPLOCALPORT)
+}
+
+// SetIPLocalPort sets the local address in "a.b.c.d;port" form
+// (SASL_IPLOCALPORT).
+func (ss *Server) SetIPLocalPort(addr string) error {
+	return ss.setString(C.SASL_IPLOCALPORT, addr)
+}
+
+// GetIPRemotePort gets the remote address in "a.b.c.d;port" form
+// (SASL_IPREMOTEPORT).
+func (ss *Server) GetIPRemotePort() (string, error) {
+	return ss.getString(C.SASL_IPREMOTEPORT)
+}
+
+// SetIPRemotePort sets the remote address in "a.b.c.d;port" form
+// (SASL_IPREMOTEPORT).
+func (ss *Server) SetIPRemotePort(addr string) error {
+	return ss.setString(C.SASL_IPREMOTEPORT, addr)
+}
+
+// GetAppName gets the application name passed to Init (SASL_APPNAME).
+func (ss *Server) GetAppName() (string, error) {
+	return ss.getString(C.SASL_APPNAME)
+}
+
+// GetGSSPeerName gets the GSS-API name of the client (SASL_GSS_PEER_NAME).
+func (ss *Server) GetGSSPeerName() (string, error) {
+	return ss.getString(C.SASL_GSS_PEER_NAME)
+}
+
+// GetAuthSource gets the name of the source that authenticated the user
+// (SASL_AUTHSOURCE).
+func (ss *Server) GetAuthSource() (string, error) {
+	return ss.getString(C.SASL_AUTHSOURCE)
+}
+
+// getString locks the client and collects a string property.
+func (cl *Client) getString(prop C.int) (string, error) {
+	conn, err := cl.lock("getprop")
+	if err != nil {
+		return "", err
+	}
+	defer cl.mu.Unlock()
+
+	return getPropString(conn, prop)
+}
+
+// setString locks the client and sets a string property.
+func (cl *Client) setString(prop C.int, value string) error {
+	conn, err := cl.lock("setprop")
+	if err != nil {
+		return err
+	}
+	defer cl.mu.Unlock()
+
+	return setPropString(conn, prop, value)
+}
+
+// getUint locks the client and collects an unsigned property.
+func (cl *Client) getUint(prop C.int) (uint, error) {
+	conn, err := cl.lock("getprop")
+	if err != nil {
+		return 0, err
+	}
+	defer cl.mu.Unlock()
+
+	return getPropUint(conn, prop)
+}
+
+// getString locks the server and collects a string property.
+func (ss *Server) getString(prop C.int) (string, error) {
+	conn, err := ss.lock("getprop")
+	if err != nil {
+		return "", err
+	}
+	defer ss.mu.Unlock()
+
+	return getPropString(conn, prop)
+}
+
+// setString locks the server and sets a string property.
+func (ss *Server) setString(prop C.int, value string) error {
+	conn, err := ss.lock("setprop")
+	if err != nil {
+		return err
+	}
+	defer ss.mu.Unlock()
+
+	return setPropString(conn, prop, value)
+}
+
+// getUint locks the server and collects an unsigned property.
+func (ss *Server) getUint(prop C.int) (uint, error) {
+	conn, err := ss.lock("getprop")
+	if err != nil {
+		return 0, err
+	}
+	defer ss.mu.Unlock()
+
+	return getPropUint(conn, prop)
+}
@@ -0,0 +1,42 @@
+package sasl
+
+import "testing"
+
+// TestClientProperties reads and writes client properties.
+func TestClientProperties(t *testing.T) {
+	cl := NewTestClient(t)
+	defer cl.Free()
+
+	if service, err := cl.GetService(); err != nil || service != "service" {
+		t.Errorf("unexpected service %q: %v", service, err)
+	}
+	if fqdn, err := cl.GetServerFQDN(); err != nil || fqdn != "hostname" {
+		t.Errorf("unexpected server FQDN %q: %v", fqdn, err)
+	}
+
+	if err := cl.SetIPLocalPort("127.0.0.1;1234"); err != nil {
+		t.Fatalf("could not set local address: %v", err)
+	}
+	if addr, err := cl.GetIPLocalPort(); err != nil || addr != "127.0.0.1;1234" {
+		t.Errorf("unexpected local address %q: %v", addr, err)
+	}
+	if err := cl.SetIPRemotePort("not an address"); err == nil {
+		t.Errorf("expected an error for an invalid remote address")
+	}
+}
+
+// TestServerProperties reads and writes server properties.
+func TestServerProperties(t *testing.T) {
+	ss := NewTestServer(t, nil)
+	defer ss.Free()
+
+	if err := ss.SetDefUserRealm("EXAMPLE.COM"); err != nil {
+		t.Fatalf("could not set realm: %v", err)
+	}
+	if realm, err := ss.GetDefUserRealm(); err != nil || realm != "EXAMPLE.COM" {
+		t.Errorf("unexpected realm %q: %v", realm, err)
+	}
+	if _, err := ss.GetAppName(); err != nil {
+		t.Errorf("could not get app name: %v", err)
+	}
+}
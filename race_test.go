@@ -0,0 +1,228 @@
+package sasl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// NewDoneClient creates a client whose PLAIN handshake has completed, so
+// that Encode and Decode can be used without a server.
+func NewDoneClient(t *testing.T) *Client {
+	cl := NewPlainClient(t)
+
+	_, _, done, err := cl.Start([]string{"PLAIN"})
+	if err != nil {
+		t.Fatalf("could not start PLAIN: %v", err)
+	}
+	if !done {
+		t.Fatalf("PLAIN should complete in a single step")
+	}
+	return cl
+}
+
+// NewPlainClient creates a client with everything PLAIN needs to complete.
+func NewPlainClient(t *testing.T) *Client {
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "user",
+		Authname: "user",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	return cl
+}
+
+// TestConcurrentClient uses a client from many goroutines while it is freed.
+func TestConcurrentClient(t *testing.T) {
+	cl := NewDoneClient(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := cl.Encode([]byte("data"))
+				if err != nil && !errors.Is(err, ErrFreed) {
+					t.Errorf("unexpected encode error: %v", err)
+					return
+				}
+				cl.Decode([]byte("data"))
+				cl.GetSSF()
+				cl.GetMechName()
+			}
+		}()
+	}
+
+	cl.Free()
+	wg.Wait()
+
+	if _, err := cl.Encode([]byte("data")); !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
+
+// TestConcurrentWrap reads from and writes to a wrapped stream at the same
+// time.
+func TestConcurrentWrap(t *testing.T) {
+	cl := NewDoneClient(t)
+	defer cl.Free()
+
+	var in, out bytes.Buffer
+	in.WriteString("data")
+	var mu sync.Mutex
+	rw, err := cl.Wrap(&lockedReadWriter{r: &in, w: &out, mu: &mu})
+	if err != nil {
+		t.Fatalf("could not wrap: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rw.Read(make([]byte, 4))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			rw.Write([]byte("data"))
+		}
+	}()
+	wg.Wait()
+}
+
+// TestConcurrentServer steps a server from many goroutines while it is
+// freed.
+func TestConcurrentServer(t *testing.T) {
+	ss := NewTestServer(t, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ss.Step([]byte("data"))
+				ss.ListMech()
+				ss.GetAppName()
+			}
+		}()
+	}
+
+	ss.Free()
+	wg.Wait()
+}
+
+// TestFreeInCallback frees a client from its prompt callback, which used to
+// deadlock.
+func TestFreeInCallback(t *testing.T) {
+	var cl *Client
+	var states []State
+	cl, err := NewClient("service", "hostname", &Config{
+		Prompt: func(ctx context.Context, p Prompt) (string, error) {
+			states = append(states, cl.State())
+			cl.Free()
+			return "user", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	_, _, _, err = cl.Start([]string{"PLAIN"})
+	if !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+	if len(states) == 0 || states[0] != StateNew {
+		t.Errorf("expected state new in the first prompt, got %v", states)
+	}
+	if state := cl.State(); state != StateFreed {
+		t.Errorf("expected state freed, got %v", state)
+	}
+}
+
+// TestFreeDuringPrompt frees a client from another goroutine while a prompt
+// is waiting for input.
+func TestFreeDuringPrompt(t *testing.T) {
+	prompted := make(chan struct{})
+	release := make(chan struct{})
+	cl, err := NewClient("service", "hostname", &Config{
+		Prompt: func(ctx context.Context, p Prompt) (string, error) {
+			close(prompted)
+			<-release
+			return "", errors.New("released")
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+
+	errc := make(chan error)
+	go func() {
+		_, _, _, err := cl.Start([]string{"PLAIN"})
+		errc <- err
+	}()
+
+	<-prompted
+	cl.Free()
+	if state := cl.State(); state != StateFreed {
+		t.Errorf("expected state freed, got %v", state)
+	}
+	close(release)
+	if err := <-errc; !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+	if _, err := cl.GetUsername(); !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
+
+// TestServerFreeInCallback frees a server from its Canonicalize callback.
+func TestServerFreeInCallback(t *testing.T) {
+	var ss *Server
+	ss = NewMechServer(t, &ServerConfig{
+		Canonicalize: func(ctx context.Context, user, realm string,
+			flags CanonFlags) (string, error) {
+			if state := ss.State(); state != StateNew &&
+				state != StateNegotiating {
+				t.Errorf("unexpected state in the callback: %v", state)
+			}
+			ss.Free()
+			return user, nil
+		},
+	})
+	cl := NewPlainClient(t)
+	defer cl.Free()
+
+	if err := mechHandshake(cl, ss); !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+	if state := ss.State(); state != StateFreed {
+		t.Errorf("expected state freed, got %v", state)
+	}
+}
+
+// lockedReadWriter is an io.ReadWriter over two buffers that may be used
+// concurrently.
+type lockedReadWriter struct {
+	r, w *bytes.Buffer
+	mu   *sync.Mutex
+}
+
+func (l *lockedReadWriter) Read(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(b)
+}
+
+func (l *lockedReadWriter) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(b)
+}
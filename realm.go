@@ -0,0 +1,67 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// RealmFunc chooses the realm to authenticate in among the realms offered
+// by the server, e.g. by DIGEST-MD5 when it offers more than one. An error
+// fails the step and is returned by Start or Step (SASL_CB_GETREALM). ctx is
+// the context passed to StartContext or StepContext, or
+// context.Background().
+type RealmFunc func(ctx context.Context, offered []string) (string, error)
+
+// ConfiguredRealm returns the RealmFunc used when Config.Realm is set and
+// Config.ChooseRealm is not: it chooses realm if the server offers it or
+// offers no realms at all.
+func ConfiguredRealm(realm string) RealmFunc {
+	return func(ctx context.Context, offered []string) (string, error) {
+		if len(offered) > 0 && !slices.Contains(offered, realm) {
+			return "", fmt.Errorf("sasl: realm %q is not offered by the server",
+				realm)
+		}
+		return realm, nil
+	}
+}
+
+// realmChooser holds the RealmFunc of a client and the realm it chose.
+type realmChooser struct {
+	fn     RealmFunc
+	chosen string
+
+	// err is the last error of fn. Mechanisms such as DIGEST-MD5 fall back
+	// to the host name of the server when the callback fails, so the
+	// client fails the step itself.
+	err error
+}
+
+// choose runs the RealmFunc for libsasl2 and returns the chosen realm in
+// result, which the caller frees.
+func (rc *realmChooser) choose(conn *C.sasl_conn_t, offered []string,
+	result **C.char) C.int {
+	realm, err := rc.fn(connContext(conn), offered)
+	if err != nil {
+		rc.err = err
+		return reportError(conn, err, C.SASL_FAIL)
+	}
+	rc.chosen = realm
+	*result = C.CString(realm)
+	return C.SASL_OK
+}
+
+// takeErr returns the error of the last choice, if any, and forgets it. rc
+// may be nil.
+func (rc *realmChooser) takeErr() error {
+	if rc == nil {
+		return nil
+	}
+	err := rc.err
+	rc.err = nil
+	return err
+}
@@ -0,0 +1,91 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// digestChallenge is the first challenge of a DIGEST-MD5 server that offers
+// two realms.
+const digestChallenge = `realm="a.example",realm="b.example",` +
+	`nonce="OA6MG9tEQGm2hh",qop="auth",charset=utf-8,algorithm=md5-sess`
+
+// digestResponse answers digestChallenge with a client configured by conf.
+// The step is passed a context with the testContextKey "realm".
+func digestResponse(t *testing.T, conf *Config) (string, error) {
+	conf.Username = "chris"
+	conf.Password = "secret"
+	cl, err := NewClient("imap", "elwood.innosoft.com", conf)
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	if _, _, _, err := cl.Start([]string{"DIGEST-MD5"}); err != nil {
+		t.Fatalf("could not start DIGEST-MD5: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), testContextKey{}, "realm")
+	response, _, err := cl.StepContext(ctx, []byte(digestChallenge))
+	return string(response), err
+}
+
+// TestConfiguredRealm chooses the configured realm only if it is offered.
+func TestConfiguredRealm(t *testing.T) {
+	response, err := digestResponse(t, &Config{Realm: "b.example"})
+	if err != nil {
+		t.Fatalf("could not answer the challenge: %v", err)
+	}
+	if !strings.Contains(response, `realm="b.example"`) {
+		t.Errorf("expected realm b.example in %q", response)
+	}
+
+	_, err = digestResponse(t, &Config{Realm: "c.example"})
+	if err == nil {
+		t.Errorf("expected an error for a realm that is not offered")
+	}
+
+	// a server that offers no realms accepts the configured one
+	realm, err := ConfiguredRealm("c.example")(context.Background(), nil)
+	if err != nil || realm != "c.example" {
+		t.Errorf("expected c.example without offered realms, got %q, %v",
+			realm, err)
+	}
+}
+
+// TestChooseRealm chooses among the offered realms with a RealmFunc.
+func TestChooseRealm(t *testing.T) {
+	var offered []string
+	response, err := digestResponse(t, &Config{
+		Realm: "b.example",
+		ChooseRealm: func(ctx context.Context, realms []string) (string,
+			error) {
+			if ctx.Value(testContextKey{}) != "realm" {
+				t.Errorf("the callback did not get the context of Step")
+			}
+			offered = realms
+			return realms[0], nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not answer the challenge: %v", err)
+	}
+	if !slices.Equal(offered, []string{"a.example", "b.example"}) {
+		t.Errorf("unexpected offered realms %v", offered)
+	}
+	if !strings.Contains(response, `realm="a.example"`) {
+		t.Errorf("expected realm a.example in %q", response)
+	}
+
+	_, err = digestResponse(t, &Config{
+		ChooseRealm: func(ctx context.Context, realms []string) (string,
+			error) {
+			return "", ErrNoUser
+		},
+	})
+	if !errors.Is(err, ErrNoUser) {
+		t.Errorf("expected ErrNoUser, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRegistered is returned when registering a plugin under a name that is
+// already taken. Plugins registered in Go cannot be unregistered: they last
+// for the lifetime of the process, across Shutdown and Init.
+var ErrRegistered = errors.New("sasl: plugin is already registered")
+
+// registry holds the plugins of one kind registered in Go, by name.
+// libsasl2 drops the plugins added to it on shutdown, so a plugin registered
+// while the library is initialized is added at once, and initLocked adds all
+// registered plugins again each time the library is initialized.
+type registry[T any] struct {
+	// kind names the plugins in ErrRegistered errors and op the
+	// registration function in the errors of add.
+	kind string
+	op   string
+
+	// add adds the plugin of an entry to libsasl2. globalMu is held.
+	add func(name string, entry T) C.int
+
+	mu      sync.RWMutex
+	entries map[string]T
+}
+
+// registries lists the registries in the order initLocked adds their
+// plugins.
+var registries = []interface{ addAll() error }{userStores, clientMechs,
+	serverMechs}
+
+// newRegistry creates a registry of plugins that add adds to libsasl2.
+func newRegistry[T any](kind, op string,
+	add func(name string, entry T) C.int) *registry[T] {
+	return &registry[T]{kind: kind, op: op, add: add,
+		entries: make(map[string]T)}
+}
+
+// register registers entry as name, and adds its plugin if the library is
+// initialized.
+func (r *registry[T]) register(name string, entry T) error {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	r.mu.Lock()
+	if _, ok := r.entries[name]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s %q", ErrRegistered, r.kind, name)
+	}
+	r.entries[name] = entry
+	r.mu.Unlock()
+
+	// plugins registered before initialization are added by initLocked
+	if global == nil {
+		return nil
+	}
+	return r.addEntry(name, entry)
+}
+
+// addEntry adds the plugin of entry. globalMu must be held.
+func (r *registry[T]) addEntry(name string, entry T) error {
+	res := r.add(name, entry)
+	if res != C.SASL_OK {
+		return newError(nil, res, r.op)
+	}
+	return nil
+}
+
+// addAll adds the plugins of all entries. globalMu must be held.
+func (r *registry[T]) addAll() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for name, entry := range r.entries {
+		if err := r.addEntry(name, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// get returns the entry registered as name.
+func (r *registry[T]) get(name string) (T, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.entries[name]
+	return entry, ok
+}
+
+// names returns the names of all entries.
+func (r *registry[T]) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var names []string
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	return names
+}
+
+// addRegistered adds the plugins of all registries. globalMu must be held.
+func addRegistered() error {
+	for _, r := range registries {
+		if err := r.addAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
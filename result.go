@@ -0,0 +1,46 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+import "C"
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/freddierice/go-sasl.v4/session"
+)
+
+// AuthResult is session.AuthResult.
+type AuthResult = session.AuthResult
+
+// newResult collects the result of a completed handshake from conn.
+func newResult(conn *C.struct_sasl_conn, realm string, externalSSF uint32,
+	completed time.Time) (*AuthResult, error) {
+	var err error
+	r := &AuthResult{
+		Realm:       realm,
+		ExternalSSF: uint(externalSSF),
+		Completed:   completed,
+	}
+
+	if r.Mechanism, err = getPropString(conn, C.SASL_MECHNAME); err != nil {
+		return nil, err
+	}
+	if r.AuthzID, err = getPropString(conn, C.SASL_USERNAME); err != nil {
+		return nil, err
+	}
+	// mechanisms such as ANONYMOUS do not set an authentication identity
+	r.AuthnID, err = getPropString(conn, C.SASL_AUTHUSER)
+	if err != nil && !errors.Is(err, ErrNotDone) {
+		return nil, err
+	}
+	if r.SSF, err = getPropUint(conn, C.SASL_SSF); err != nil {
+		return nil, err
+	}
+	if r.MaxOutBuf, err = getPropUint(conn, C.SASL_MAXOUTBUF); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
@@ -0,0 +1,119 @@
+package sasl
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestClientResult checks the result of a PLAIN handshake.
+func TestClientResult(t *testing.T) {
+	start := time.Now()
+	cl := NewDoneClient(t)
+	defer cl.Free()
+
+	r, err := cl.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.Mechanism != "PLAIN" {
+		t.Errorf("expected mechanism PLAIN, got %q", r.Mechanism)
+	}
+	if r.AuthnID != "user" || r.AuthzID != "user" {
+		t.Errorf("expected identities user and user, got %q and %q",
+			r.AuthnID, r.AuthzID)
+	}
+	if r.SSF != 0 {
+		t.Errorf("expected no security layer, got ssf %v", r.SSF)
+	}
+	if r.Completed.Before(start) {
+		t.Errorf("completion time %v is before the handshake", r.Completed)
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatalf("could not marshal the result: %v", err)
+	}
+	var decoded AuthResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("could not unmarshal the result: %v", err)
+	}
+	if decoded.Mechanism != r.Mechanism || !decoded.Completed.Equal(r.Completed) {
+		t.Errorf("result did not survive JSON: %s", data)
+	}
+}
+
+// TestResultNotDone checks that there is no result before authentication.
+func TestResultNotDone(t *testing.T) {
+	cl := NewPlainClient(t)
+	defer cl.Free()
+	if _, err := cl.Result(); !errors.Is(err, ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+
+	ss := NewTestServer(t, nil)
+	defer ss.Free()
+	if _, err := ss.Result(); !errors.Is(err, ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+}
+
+// TestClientAuthzID checks that a PLAIN handshake can act as another user.
+func TestClientAuthzID(t *testing.T) {
+	cl, err := NewClient("service", "hostname", &Config{
+		Authname: "admin",
+		AuthzID:  "user",
+		Password: "pass",
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	if _, _, _, err := cl.Start([]string{"PLAIN"}); err != nil {
+		t.Fatalf("could not start PLAIN: %v", err)
+	}
+	r, err := cl.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.AuthnID != "admin" || r.AuthzID != "user" {
+		t.Errorf("expected identities admin and user, got %q and %q",
+			r.AuthnID, r.AuthzID)
+	}
+}
+
+// TestResultRealm checks that the realm of a result is the one the
+// handshake used, also for identities that contain "@".
+func TestResultRealm(t *testing.T) {
+	ss := NewMechServer(t, &ServerConfig{Realm: "corp"})
+	defer ss.Free()
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "bob@example.com",
+		Password: "secret",
+		Realm:    "corp",
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+
+	if err := mechHandshake(cl, ss); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	sides := []struct {
+		name   string
+		result func() (*AuthResult, error)
+	}{{"client", cl.Result}, {"server", ss.Result}}
+	for _, side := range sides {
+		r, err := side.result()
+		if err != nil {
+			t.Fatalf("could not get the %v result: %v", side.name, err)
+		}
+		if r.AuthnID != "bob@example.com" || r.Realm != "corp" {
+			t.Errorf("expected bob@example.com in realm corp on the %v, "+
+				"got %q in %q", side.name, r.AuthnID, r.Realm)
+		}
+	}
+}
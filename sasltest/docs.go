@@ -0,0 +1,5 @@
+// Package sasltest provides utilities for testing code that uses package
+// sasl: a temporary sasldb of users or an in-memory sasl.UserStore, servers
+// configured against either, and a driver for complete client/server
+// handshakes. Fakes that need no libsasl2 are in package sasltest/fake.
+package sasltest
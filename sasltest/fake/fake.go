@@ -0,0 +1,392 @@
+// Package fake provides scriptable fakes of the Client and Server of package
+// sasl for unit tests that should not depend on libsasl2, its mechanism
+// plugins or real credentials. It only depends on package session, so tests
+// that use it build without cgo.
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gopkg.in/freddierice/go-sasl.v4/session"
+)
+
+// Exchange is a single step of a scripted handshake: the message a fake
+// expects from its peer and what it answers.
+type Exchange struct {
+	// Expect is the message the fake expects. If nil, any message is
+	// accepted. The message does not match if Expect is non-nil and empty
+	// but the peer sent nil, e.g. no initial response.
+	Expect []byte
+	// Send is the answer to the message.
+	Send []byte
+	// Err, if set, is returned instead of Send and fails the handshake.
+	Err error
+}
+
+// player holds what Client and Server have in common.
+type player struct {
+	mu      sync.Mutex
+	next    int
+	state   session.State
+	mech    string
+	done    time.Time
+	encoder func([]byte) ([]byte, error)
+	decoder func([]byte) ([]byte, error)
+}
+
+// Script is the configuration shared by Client and Server.
+type Script struct {
+	// Exchanges are played in order, one per Start or Step. The handshake
+	// is done once the last one has been played.
+	Exchanges []Exchange
+	// Username is the authorization identity reported once authenticated.
+	Username string
+	// SSF is the strength of the fake security layer.
+	SSF int
+	// Encoder and Decoder transform the data of the security layer. If
+	// nil, data is passed through unchanged.
+	Encoder func([]byte) ([]byte, error)
+	Decoder func([]byte) ([]byte, error)
+}
+
+// play plays the next exchange of s for op with message from the peer,
+// which is only compared to the exchange if expect is true. f.mu must be
+// held.
+func (f *player) play(ctx context.Context, s *Script, op string,
+	message []byte, expect bool, states ...session.State) (response []byte,
+	done bool, err error) {
+	if !f.allowed(states) {
+		return nil, false, &session.StateError{Op: op, State: f.state}
+	}
+	if err := ctx.Err(); err != nil {
+		f.state = session.StateFailed
+		return nil, false, fmt.Errorf("%w: %v: %w", session.ErrAborted, op, err)
+	}
+	if f.next >= len(s.Exchanges) {
+		f.state = session.StateFailed
+		return nil, false, fmt.Errorf("%w: fake: %v: script has no "+
+			"exchange %v", session.ErrBadProt, op, f.next)
+	}
+
+	e := s.Exchanges[f.next]
+	f.next++
+	if expect && e.Expect != nil &&
+		(message == nil || !bytes.Equal(e.Expect, message)) {
+		f.state = session.StateFailed
+		return nil, false, fmt.Errorf("%w: fake: %v: expected %q, got "+
+			"%q", session.ErrBadProt, op, e.Expect, message)
+	}
+	if e.Err != nil {
+		f.state = session.StateFailed
+		return nil, false, e.Err
+	}
+
+	if f.next < len(s.Exchanges) {
+		f.state = session.StateNegotiating
+		return e.Send, false, nil
+	}
+	f.state = session.StateAuthenticated
+	f.done = time.Now()
+	f.encoder, f.decoder = s.Encoder, s.Decoder
+	return e.Send, true, nil
+}
+
+// allowed reports whether f is in one of states. f.mu must be held.
+func (f *player) allowed(states []session.State) bool {
+	for _, state := range states {
+		if f.state == state {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns a *session.StateError if f is not in one of states.
+func (f *player) check(op string, states ...session.State) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.allowed(states) {
+		return &session.StateError{Op: op, State: f.state}
+	}
+	return nil
+}
+
+// transform runs fn on buf once authenticated.
+func (f *player) transform(op string, buf []byte,
+	fn func(f *player) func([]byte) ([]byte, error)) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.state != session.StateAuthenticated {
+		return nil, &session.StateError{Op: op, State: f.state}
+	}
+	if transform := fn(f); transform != nil {
+		return transform(buf)
+	}
+	return append([]byte(nil), buf...), nil
+}
+
+// Encode implements session.Wrapable.
+func (f *player) Encode(buf []byte) ([]byte, error) {
+	return f.transform("Encode", buf, func(f *player) func([]byte) ([]byte,
+		error) {
+		return f.encoder
+	})
+}
+
+// Decode implements session.Wrapable.
+func (f *player) Decode(buf []byte) ([]byte, error) {
+	return f.transform("Decode", buf, func(f *player) func([]byte) ([]byte,
+		error) {
+		return f.decoder
+	})
+}
+
+// State returns the stage of the handshake the fake is in.
+func (f *player) State() session.State {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.state
+}
+
+// Free moves the fake to session.StateFreed.
+func (f *player) Free() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.state = session.StateFreed
+}
+
+// result summarizes the handshake of f for s.
+func (f *player) result(s *Script) (*session.AuthResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.state != session.StateAuthenticated {
+		return nil, &session.StateError{Op: "Result", State: f.state}
+	}
+	return &session.AuthResult{
+		Mechanism: f.mech,
+		AuthnID:   s.Username,
+		AuthzID:   s.Username,
+		SSF:       uint(s.SSF),
+		Completed: f.done,
+	}, nil
+}
+
+// authenticated returns value if f is authenticated.
+func authenticated[T any](f *player, op string, value T) (T, error) {
+	if err := f.check(op, session.StateAuthenticated); err != nil {
+		var zero T
+		return zero, err
+	}
+	return value, nil
+}
+
+// Client is a session.ClientSession that plays a script instead of running
+// a mechanism.
+type Client struct {
+	// Mech is the mechanism chosen by Start. It must be in the mechlist
+	// passed to Start.
+	Mech string
+	Script
+	player
+}
+
+// NewClient creates a Client that chooses mech and plays exchanges.
+// The first exchange answers Start, so its Expect is ignored.
+func NewClient(mech string, exchanges ...Exchange) *Client {
+	return &Client{Mech: mech, Script: Script{Exchanges: exchanges}}
+}
+
+// Start implements session.ClientSession.
+func (fc *Client) Start(mechlist []string) (mech string, response []byte,
+	done bool, err error) {
+	return fc.StartContext(context.Background(), mechlist)
+}
+
+// StartContext implements session.ClientSession.
+func (fc *Client) StartContext(ctx context.Context, mechlist []string) (
+	mech string, response []byte, done bool, err error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.state == session.StateNew && !contains(mechlist, fc.Mech) {
+		fc.state = session.StateFailed
+		return "", nil, false, fmt.Errorf("%w: fake: %v is not in %v",
+			session.ErrNoMech, fc.Mech, mechlist)
+	}
+	// there is no challenge to check before the initial response
+	response, done, err = fc.play(ctx, &fc.Script, "Start", nil, false,
+		session.StateNew)
+	if err != nil {
+		return "", nil, false, err
+	}
+	fc.mech = fc.Mech
+	return fc.Mech, response, done, nil
+}
+
+// Step implements session.ClientSession.
+func (fc *Client) Step(challenge []byte) (response []byte, done bool,
+	err error) {
+	return fc.StepContext(context.Background(), challenge)
+}
+
+// StepContext implements session.ClientSession.
+func (fc *Client) StepContext(ctx context.Context, challenge []byte) (
+	response []byte, done bool, err error) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	return fc.play(ctx, &fc.Script, "Step", challenge, true,
+		session.StateNegotiating)
+}
+
+// Wrap implements session.Wrapper.
+func (fc *Client) Wrap(rw io.ReadWriter) (io.ReadWriter, error) {
+	return authenticated(&fc.player, "Wrap", session.WrapReadWriter(fc, rw))
+}
+
+// WrapReader implements session.Wrapper.
+func (fc *Client) WrapReader(r io.Reader) (io.Reader, error) {
+	return authenticated(&fc.player, "WrapReader", session.WrapReader(fc, r))
+}
+
+// WrapWriter implements session.Wrapper.
+func (fc *Client) WrapWriter(w io.Writer) (io.Writer, error) {
+	return authenticated(&fc.player, "WrapWriter", session.WrapWriter(fc, w))
+}
+
+// GetSSF implements session.Wrapper.
+func (fc *Client) GetSSF() (int, error) {
+	return authenticated(&fc.player, "GetSSF", fc.SSF)
+}
+
+// GetUsername implements session.ClientSession.
+func (fc *Client) GetUsername() (string, error) {
+	return authenticated(&fc.player, "GetUsername", fc.Username)
+}
+
+// Result implements session.ClientSession.
+func (fc *Client) Result() (*session.AuthResult, error) {
+	return fc.result(&fc.Script)
+}
+
+// Server is a session.ServerSession that plays a script instead of running
+// a mechanism.
+type Server struct {
+	// Mechs are the mechanisms returned by ListMech. If not empty, Start
+	// fails with session.ErrNoMech for other mechanisms.
+	Mechs []string
+	Script
+	player
+}
+
+// NewServer creates a Server that offers mechs and plays exchanges.
+// The first exchange answers the initial response passed to Start.
+func NewServer(mechs []string, exchanges ...Exchange) *Server {
+	return &Server{Mechs: mechs, Script: Script{Exchanges: exchanges}}
+}
+
+// ListMech implements session.ServerSession.
+func (fs *Server) ListMech() ([]string, error) {
+	if err := fs.check("ListMech", session.StateNew, session.StateNegotiating,
+		session.StateAuthenticated, session.StateFailed); err != nil {
+		return nil, err
+	}
+	return append([]string(nil), fs.Mechs...), nil
+}
+
+// Start implements session.ServerSession.
+func (fs *Server) Start(mech string, challenge []byte) (response []byte,
+	done bool, err error) {
+	return fs.StartContext(context.Background(), mech, challenge)
+}
+
+// StartContext implements session.ServerSession.
+func (fs *Server) StartContext(ctx context.Context, mech string,
+	challenge []byte) (response []byte, done bool, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.state == session.StateNew && len(fs.Mechs) > 0 &&
+		!contains(fs.Mechs, mech) {
+		fs.state = session.StateFailed
+		return nil, false, fmt.Errorf("%w: fake: %v is not offered",
+			session.ErrNoMech, mech)
+	}
+	response, done, err = fs.play(ctx, &fs.Script, "Start", challenge, true,
+		session.StateNew)
+	if err == nil {
+		fs.mech = mech
+	}
+	return response, done, err
+}
+
+// Step implements session.ServerSession.
+func (fs *Server) Step(challenge []byte) (response []byte, done bool,
+	err error) {
+	return fs.StepContext(context.Background(), challenge)
+}
+
+// StepContext implements session.ServerSession.
+func (fs *Server) StepContext(ctx context.Context, challenge []byte) (
+	response []byte, done bool, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.play(ctx, &fs.Script, "Step", challenge, true,
+		session.StateNegotiating)
+}
+
+// Wrap implements session.Wrapper.
+func (fs *Server) Wrap(rw io.ReadWriter) (io.ReadWriter, error) {
+	return authenticated(&fs.player, "Wrap", session.WrapReadWriter(fs, rw))
+}
+
+// WrapReader implements session.Wrapper.
+func (fs *Server) WrapReader(r io.Reader) (io.Reader, error) {
+	return authenticated(&fs.player, "WrapReader", session.WrapReader(fs, r))
+}
+
+// WrapWriter implements session.Wrapper.
+func (fs *Server) WrapWriter(w io.Writer) (io.Writer, error) {
+	return authenticated(&fs.player, "WrapWriter", session.WrapWriter(fs, w))
+}
+
+// GetSSF implements session.Wrapper.
+func (fs *Server) GetSSF() (int, error) {
+	return authenticated(&fs.player, "GetSSF", fs.SSF)
+}
+
+// GetUsername implements session.ServerSession.
+func (fs *Server) GetUsername() (string, error) {
+	return authenticated(&fs.player, "GetUsername", fs.Username)
+}
+
+// Result implements session.ServerSession.
+func (fs *Server) Result() (*session.AuthResult, error) {
+	return fs.result(&fs.Script)
+}
+
+// contains reports whether list contains s.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	_ session.ClientSession = (*Client)(nil)
+	_ session.ServerSession = (*Server)(nil)
+)
@@ -0,0 +1,170 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"gopkg.in/freddierice/go-sasl.v4/session"
+)
+
+// plain is the initial response of PLAIN for alice.
+var plain = []byte("\x00alice\x00secret")
+
+// TestHandshake runs a scripted challenge/response between two fakes.
+func TestHandshake(t *testing.T) {
+	fc := NewClient("FAKE",
+		Exchange{Send: []byte("hello")},
+		Exchange{Expect: []byte("challenge"), Send: []byte("response")},
+		Exchange{Expect: []byte("welcome")},
+	)
+	fc.Username = "alice"
+	fs := NewServer([]string{"FAKE"},
+		Exchange{Expect: []byte("hello"), Send: []byte("challenge")},
+		Exchange{Expect: []byte("response"), Send: []byte("welcome")},
+	)
+	fs.Username = "alice"
+
+	mech, response, _, err := fc.Start([]string{"OTHER", "FAKE"})
+	if err != nil || mech != "FAKE" {
+		t.Fatalf("could not start FAKE (%v): %v", mech, err)
+	}
+	challenge, _, err := fs.Start(mech, response)
+	if err != nil {
+		t.Fatalf("server could not start: %v", err)
+	}
+	if response, _, err = fc.Step(challenge); err != nil {
+		t.Fatalf("client could not step: %v", err)
+	}
+	challenge, done, err := fs.Step(response)
+	if err != nil || !done {
+		t.Fatalf("server is not done (%v): %v", done, err)
+	}
+	if _, done, err = fc.Step(challenge); err != nil || !done {
+		t.Fatalf("client is not done (%v): %v", done, err)
+	}
+
+	r, err := fs.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.Mechanism != "FAKE" || r.AuthzID != "alice" {
+		t.Errorf("unexpected result %+v", r)
+	}
+	if state := fc.State(); state != session.StateAuthenticated {
+		t.Errorf("expected state authenticated, got %v", state)
+	}
+}
+
+// TestErrors checks injected errors and unexpected messages.
+func TestErrors(t *testing.T) {
+	injected := errors.New("injected")
+	fs := NewServer(nil,
+		Exchange{Send: []byte("challenge")},
+		Exchange{Err: injected},
+	)
+	if _, _, err := fs.Start("FAKE", nil); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	if _, _, err := fs.Step(nil); !errors.Is(err, injected) {
+		t.Errorf("expected the injected error, got %v", err)
+	}
+	if state := fs.State(); state != session.StateFailed {
+		t.Errorf("expected state failed, got %v", state)
+	}
+
+	fs = NewServer([]string{"PLAIN"}, Exchange{Expect: plain})
+	if _, _, err := fs.Start("PLAIN", []byte("wrong")); !errors.Is(err,
+		session.ErrBadProt) {
+		t.Errorf("expected ErrBadProt, got %v", err)
+	}
+
+	fs = NewServer([]string{"PLAIN"}, Exchange{Expect: plain})
+	if _, _, err := fs.Start("LOGIN", plain); !errors.Is(err,
+		session.ErrNoMech) {
+		t.Errorf("expected ErrNoMech, got %v", err)
+	}
+
+	fc := NewClient("PLAIN", Exchange{Send: plain})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err := fc.StartContext(ctx, []string{"PLAIN"})
+	if !errors.Is(err, session.ErrAborted) {
+		t.Errorf("expected ErrAborted, got %v", err)
+	}
+}
+
+// TestMisuse checks that fakes enforce the states of the real types.
+func TestMisuse(t *testing.T) {
+	fc := NewClient("PLAIN", Exchange{Send: plain})
+	if _, _, err := fc.Step(nil); !errors.Is(err, session.ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+	if _, err := fc.Encode([]byte("data")); !errors.Is(err,
+		session.ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+
+	fc.Free()
+	_, _, _, err := fc.Start([]string{"PLAIN"})
+	if !errors.Is(err, session.ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
+
+// TestSecurityLayer wraps a pipe with fake encode and decode transforms.
+func TestSecurityLayer(t *testing.T) {
+	xor := func(buf []byte) ([]byte, error) {
+		out := make([]byte, len(buf))
+		for i, b := range buf {
+			out[i] = b ^ 0x5a
+		}
+		return out, nil
+	}
+	fc := NewClient("FAKE", Exchange{})
+	fc.SSF, fc.Encoder, fc.Decoder = 56, xor, xor
+	fs := NewServer(nil, Exchange{})
+	fs.SSF, fs.Encoder, fs.Decoder = 56, xor, xor
+	if _, _, _, err := fc.Start([]string{"FAKE"}); err != nil {
+		t.Fatalf("client could not start: %v", err)
+	}
+	if _, _, err := fs.Start("FAKE", nil); err != nil {
+		t.Fatalf("server could not start: %v", err)
+	}
+	if ssf, _ := fc.GetSSF(); ssf != 56 {
+		t.Errorf("expected ssf 56, got %v", ssf)
+	}
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+	clientW, err := fc.WrapWriter(clientConn)
+	if err != nil {
+		t.Fatalf("could not wrap the client: %v", err)
+	}
+	serverR, err := fs.WrapReader(serverConn)
+	if err != nil {
+		t.Fatalf("could not wrap the server: %v", err)
+	}
+
+	raw := make([]byte, 4)
+	go clientW.Write([]byte("data"))
+	if _, err := io.ReadFull(serverConn, raw); err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if bytes.Equal(raw, []byte("data")) {
+		t.Errorf("data was not encoded")
+	}
+
+	go clientW.Write([]byte("data"))
+	got := make([]byte, 4)
+	if _, err := io.ReadFull(serverR, got); err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if string(got) != "data" {
+		t.Errorf("expected data, got %q", got)
+	}
+}
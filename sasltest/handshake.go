@@ -0,0 +1,47 @@
+package sasltest
+
+import (
+	"fmt"
+
+	sasl "gopkg.in/freddierice/go-sasl.v4"
+)
+
+// Handshake authenticates cl to ss, passing the messages between them the
+// way a protocol would. The client chooses a mechanism from mechlist. It
+// returns the chosen mechanism and the first error of either side.
+func Handshake(cl sasl.ClientSession, ss sasl.ServerSession,
+	mechlist []string) (string, error) {
+	mech, response, clientDone, err := cl.Start(mechlist)
+	if err != nil {
+		return mech, err
+	}
+	challenge, serverDone, err := ss.Start(mech, response)
+	if err != nil {
+		return mech, err
+	}
+
+	for !serverDone {
+		response, clientDone, err = cl.Step(challenge)
+		if err != nil {
+			return mech, err
+		}
+		challenge, serverDone, err = ss.Step(response)
+		if err != nil {
+			return mech, err
+		}
+	}
+
+	// the server may send additional data with its outcome, such as the
+	// proof of its identity, that the client must check
+	if !clientDone {
+		_, clientDone, err = cl.Step(challenge)
+		if err != nil {
+			return mech, err
+		}
+	}
+	if !clientDone {
+		return mech, fmt.Errorf("sasltest: %v: client is not done after "+
+			"the server", mech)
+	}
+	return mech, nil
+}
@@ -0,0 +1,353 @@
+package sasltest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	sasl "gopkg.in/freddierice/go-sasl.v4"
+	"gopkg.in/freddierice/go-sasl.v4/sasltest/fake"
+)
+
+// users are the users of the test sasldb.
+var users = map[string]string{
+	"alice": "secret",
+	"admin": "hunter2",
+}
+
+// NewTestClient creates a client for user that is freed when the test ends.
+func NewTestClient(t *testing.T, conf *sasl.Config) *sasl.Client {
+	t.Helper()
+
+	conf.Realm = Host
+	cl, err := sasl.NewClient(Service, Host, conf)
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	t.Cleanup(cl.Free)
+	return cl
+}
+
+// TestHandshake authenticates with every mechanism that checks passwords.
+func TestHandshake(t *testing.T) {
+	db := NewDB(t, users)
+
+	mechs := []string{"PLAIN", "LOGIN", "CRAM-MD5", "DIGEST-MD5",
+		"SCRAM-SHA-1", "SCRAM-SHA-256"}
+	for _, mech := range mechs {
+		t.Run(mech, func(t *testing.T) {
+			ss := NewServer(t, db, nil)
+			cl := NewTestClient(t, &sasl.Config{
+				Username: "alice",
+				Password: "secret",
+			})
+
+			chosen, err := Handshake(cl, ss, []string{mech})
+			if err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+			if chosen != mech {
+				t.Errorf("expected %v, got %v", mech, chosen)
+			}
+
+			r, err := ss.Result()
+			if err != nil {
+				t.Fatalf("could not get the result: %v", err)
+			}
+			if r.Mechanism != mech {
+				t.Errorf("expected mechanism %v, got %v", mech, r.Mechanism)
+			}
+			if r.AuthzID != "alice" {
+				t.Errorf("expected alice, got %q", r.AuthzID)
+			}
+		})
+	}
+}
+
+// TestHandshakeBadPassword checks that a wrong password is an auth failure.
+func TestHandshakeBadPassword(t *testing.T) {
+	db := NewDB(t, users)
+
+	for _, mech := range []string{"PLAIN", "CRAM-MD5", "SCRAM-SHA-256"} {
+		t.Run(mech, func(t *testing.T) {
+			ss := NewServer(t, db, nil)
+			cl := NewTestClient(t, &sasl.Config{
+				Username: "alice",
+				Password: "wrong",
+			})
+
+			_, err := Handshake(cl, ss, []string{mech})
+			if !sasl.IsAuthFailure(err) {
+				t.Errorf("expected an auth failure, got %v", err)
+			}
+			if state := ss.State(); state != sasl.StateFailed {
+				t.Errorf("expected state failed, got %v", state)
+			}
+		})
+	}
+}
+
+// TestHandshakeProxy checks that a proxy may act as another user only if
+// the server authorizes it.
+func TestHandshakeProxy(t *testing.T) {
+	db := NewDB(t, users)
+	conf := &sasl.Config{
+		Authname: "admin",
+		AuthzID:  "alice",
+		Password: "hunter2",
+	}
+
+	ss := NewServer(t, db, nil)
+	_, err := Handshake(NewTestClient(t, conf), ss, []string{"PLAIN"})
+	if !sasl.IsAuthFailure(err) {
+		t.Errorf("expected an auth failure without a policy, got %v", err)
+	}
+
+	ss = NewServer(t, db, &sasl.ServerConfig{
+		Authorize: func(ctx context.Context, authnID, authzID string) error {
+			if authnID != "admin" {
+				return errors.New("only admin may proxy")
+			}
+			return nil
+		},
+	})
+	_, err = Handshake(NewTestClient(t, conf), ss, []string{"PLAIN"})
+	if err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	r, err := ss.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.AuthnID != "admin" || r.AuthzID != "alice" {
+		t.Errorf("expected identities admin and alice, got %q and %q",
+			r.AuthnID, r.AuthzID)
+	}
+}
+
+// TCPLoopback connects to a listener on 127.0.0.1 and returns both ends of
+// the connection, which are closed when the test ends.
+func TCPLoopback(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	defer l.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			conn = nil
+		}
+		accepted <- conn
+	}()
+	client, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server = <-accepted
+	if server == nil {
+		t.Fatalf("could not accept")
+	}
+	t.Cleanup(func() { server.Close() })
+	return client, server
+}
+
+// ipPort formats the port of addr on 127.0.0.1 the way libsasl2 expects.
+func ipPort(addr net.Addr) string {
+	return fmt.Sprintf("127.0.0.1;%d", addr.(*net.TCPAddr).Port)
+}
+
+// TestSecurityLayer exchanges data over a DIGEST-MD5 security layer.
+func TestSecurityLayer(t *testing.T) {
+	db := NewDB(t, users)
+	clientConn, serverConn := TCPLoopback(t)
+
+	ss := NewServer(t, db, &sasl.ServerConfig{
+		LocalAddr:  serverConn.LocalAddr(),
+		RemoteAddr: serverConn.RemoteAddr(),
+		MinSsf:     56,
+	})
+	cl := NewTestClient(t, &sasl.Config{
+		Username:   "alice",
+		Password:   "secret",
+		LocalAddr:  clientConn.LocalAddr(),
+		RemoteAddr: clientConn.RemoteAddr(),
+		MinSsf:     56,
+	})
+
+	// DIGEST-MD5 needs the addresses for its security layer
+	addrs := []struct {
+		name string
+		get  func() (string, error)
+		addr net.Addr
+	}{
+		{"client local", cl.GetIPLocalPort, clientConn.LocalAddr()},
+		{"client remote", cl.GetIPRemotePort, clientConn.RemoteAddr()},
+		{"server local", ss.GetIPLocalPort, serverConn.LocalAddr()},
+		{"server remote", ss.GetIPRemotePort, serverConn.RemoteAddr()},
+	}
+	for _, a := range addrs {
+		got, err := a.get()
+		if err != nil {
+			t.Fatalf("could not get the %v address: %v", a.name, err)
+		}
+		if want := ipPort(a.addr); got != want {
+			t.Errorf("expected %v address %q, got %q", a.name, want, got)
+		}
+	}
+
+	if _, err := Handshake(cl, ss, []string{"DIGEST-MD5"}); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	r, err := cl.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.SSF < 56 {
+		t.Fatalf("expected a security layer, got ssf %v", r.SSF)
+	}
+
+	clientRW, err := cl.Wrap(clientConn)
+	if err != nil {
+		t.Fatalf("could not wrap the client: %v", err)
+	}
+	serverRW, err := ss.Wrap(serverConn)
+	if err != nil {
+		t.Fatalf("could not wrap the server: %v", err)
+	}
+
+	// larger than the maxoutbuf of DIGEST-MD5, so it is sent in chunks
+	message := bytes.Repeat([]byte("confidential "), 10000)
+	written := make(chan error, 1)
+	go func() {
+		n, err := clientRW.Write(message)
+		if err == nil && n != len(message) {
+			err = fmt.Errorf("wrote %d of %d bytes", n, len(message))
+		}
+		written <- err
+	}()
+	got := make([]byte, len(message))
+	if _, err := io.ReadFull(serverRW, got); err != nil {
+		t.Fatalf("server could not read: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("client could not write: %v", err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Errorf("server read a different message")
+	}
+
+	go func() {
+		copied, err := io.Copy(clientRW, bytes.NewReader(message))
+		if err == nil && copied != int64(len(message)) {
+			err = fmt.Errorf("copied %d of %d bytes", copied, len(message))
+		}
+		written <- err
+	}()
+	if _, err := io.ReadFull(serverRW, got); err != nil {
+		t.Fatalf("server could not read: %v", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatalf("client could not copy: %v", err)
+	}
+	if !bytes.Equal(got, message) {
+		t.Errorf("server read a different copied message")
+	}
+
+	go func() {
+		serverRW.Write([]byte("reply"))
+	}()
+	got = make([]byte, len("reply"))
+	if _, err := io.ReadFull(clientRW, got); err != nil {
+		t.Fatalf("client could not read: %v", err)
+	}
+	if string(got) != "reply" {
+		t.Errorf("expected reply, got %q", got)
+	}
+}
+
+// TestFakeClientRealServer authenticates a fake client to a real server.
+func TestFakeClientRealServer(t *testing.T) {
+	ss := NewServer(t, NewDB(t, users), nil)
+	fc := fake.NewClient("PLAIN", fake.Exchange{
+		Send: []byte("\x00alice\x00secret"),
+	})
+
+	if _, err := Handshake(fc, ss, []string{"PLAIN"}); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	if username, _ := ss.GetUsername(); username != "alice" {
+		t.Errorf("expected alice, got %q", username)
+	}
+}
+
+// contextKey is the key of the values the tests add to the contexts they
+// pass, to check that callbacks get them.
+type contextKey struct{}
+
+// TestHandshakeProxyRefused checks that Authorize can refuse a proxy, and
+// that it gets the context of the server.
+func TestHandshakeProxyRefused(t *testing.T) {
+	db := NewDB(t, users)
+	ss := NewServer(t, db, &sasl.ServerConfig{
+		Authorize: func(ctx context.Context, authnID, authzID string) error {
+			if ctx.Value(contextKey{}) != "authorize" {
+				t.Errorf("the callback did not get the context of Start")
+			}
+			return errors.New("no proxies")
+		},
+	})
+	cl := NewTestClient(t, &sasl.Config{
+		Authname: "alice",
+		AuthzID:  "admin",
+		Password: "secret",
+	})
+
+	mech, response, _, err := cl.Start([]string{"PLAIN"})
+	if err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	ctx := context.WithValue(context.Background(), contextKey{}, "authorize")
+	_, _, err = ss.StartContext(ctx, mech, response)
+	if !errors.Is(err, sasl.ErrNoAuthz) {
+		t.Errorf("expected ErrNoAuthz, got %v", err)
+	}
+}
+
+// TestProps looks up auxiliary properties of the authenticated user.
+func TestProps(t *testing.T) {
+	ss := NewServer(t, NewDB(t, users), nil)
+	if err := ss.RequestProps("userPassword", "missing"); err != nil {
+		t.Fatalf("could not request props: %v", err)
+	}
+	cl := NewTestClient(t, &sasl.Config{
+		Username: "alice",
+		Password: "secret",
+	})
+	if _, err := Handshake(cl, ss, []string{"PLAIN"}); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+
+	props, err := ss.Props()
+	if err != nil {
+		t.Fatalf("could not get props: %v", err)
+	}
+	if len(props) != 1 || len(props["userPassword"]) != 1 ||
+		props["userPassword"][0] != "secret" {
+		t.Errorf("unexpected props %v", props)
+	}
+	var se *sasl.StateError
+	if err := ss.RequestProps("late"); !errors.As(err, &se) {
+		t.Errorf("expected a *StateError, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package sasltest
+
+import (
+	"path/filepath"
+	"testing"
+
+	sasl "gopkg.in/freddierice/go-sasl.v4"
+)
+
+const (
+	// Service is the service name of the servers created by NewServer.
+	Service = "sasltest"
+	// Host is the host name of the servers created by NewServer. It is
+	// also the realm of the users in a DB.
+	Host = "localhost"
+)
+
+// DB is a temporary sasldb.
+type DB struct {
+	// Path is the location of the sasldb file.
+	Path string
+}
+
+// NewDB creates a sasldb in a temporary directory that is removed when the
+// test ends, and adds users, a map of user names to passwords, to it.
+func NewDB(t testing.TB, users map[string]string) *DB {
+	t.Helper()
+
+	db := &DB{Path: filepath.Join(t.TempDir(), "sasldb2")}
+	ss, err := sasl.NewServerWithConfig(Service, Host, &sasl.ServerConfig{
+		Options: db.Options(),
+	})
+	if err != nil {
+		t.Fatalf("could not create server: %v", err)
+	}
+	defer ss.Free()
+
+	for user, pass := range users {
+		err := ss.SetPassword(user, "", pass, sasl.SetPassCreate)
+		if err != nil {
+			t.Fatalf("could not add %v to the sasldb: %v", user, err)
+		}
+	}
+	return db
+}
+
+// Options returns the options that make a Server check passwords against
+// db.
+func (db *DB) Options() map[string]string {
+	return map[string]string{
+		"sasldb_path":    db.Path,
+		"auxprop_plugin": "sasldb",
+		"pwcheck_method": "auxprop",
+	}
+}
+
+// NewServer creates a Server for Service on Host that checks passwords
+// against backend, such as a DB or a MemoryStore. Options in conf take
+// precedence over those of backend. The server is freed when the test ends.
+func NewServer(t testing.TB, backend Backend,
+	conf *sasl.ServerConfig) *sasl.Server {
+	t.Helper()
+
+	var c sasl.ServerConfig
+	if conf != nil {
+		c = *conf
+	}
+	options := backend.Options()
+	for key, value := range c.Options {
+		options[key] = value
+	}
+	c.Options = options
+
+	ss, err := sasl.NewServerWithConfig(Service, Host, &c)
+	if err != nil {
+		t.Fatalf("could not create server: %v", err)
+	}
+	t.Cleanup(ss.Free)
+	return ss
+}
@@ -0,0 +1,103 @@
+package sasltest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	sasl "gopkg.in/freddierice/go-sasl.v4"
+)
+
+// Backend is a password backend that servers can be configured against.
+type Backend interface {
+	// Options returns the server options that select the backend.
+	Options() map[string]string
+}
+
+// storeSeq numbers the plugins registered by NewMemoryStore, as
+// registrations cannot be undone.
+var storeSeq atomic.Uint64
+
+// MemoryStore is a sasl.UserStore that keeps users in memory.
+type MemoryStore struct {
+	// Name is the auxiliary property plugin the store is registered as.
+	Name string
+
+	mu    sync.Mutex
+	users map[string]map[string][]string
+}
+
+// NewMemoryStore registers an empty MemoryStore under a new name and adds
+// users, a map of user names to passwords in the realm Host, to it.
+func NewMemoryStore(t testing.TB, users map[string]string) *MemoryStore {
+	t.Helper()
+
+	ms := &MemoryStore{
+		Name:  fmt.Sprintf("sasltest%d", storeSeq.Add(1)),
+		users: make(map[string]map[string][]string),
+	}
+	if err := sasl.RegisterUserStore(ms.Name, ms); err != nil {
+		t.Fatalf("could not register the store: %v", err)
+	}
+	for user, pass := range users {
+		ms.Store(context.Background(), user, Host,
+			map[string][]string{"userPassword": {pass}})
+	}
+	return ms
+}
+
+// Options returns the options that make a Server check passwords against
+// ms.
+func (ms *MemoryStore) Options() map[string]string {
+	return map[string]string{
+		"auxprop_plugin": ms.Name,
+		"pwcheck_method": "auxprop",
+	}
+}
+
+// Lookup implements sasl.UserStore.
+func (ms *MemoryStore) Lookup(ctx context.Context, user, realm string,
+	props []string) (map[string][]string, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	stored, ok := ms.users[user+"@"+realm]
+	if !ok {
+		return nil, sasl.ErrNoUser
+	}
+	found := make(map[string][]string)
+	for _, prop := range props {
+		if values, ok := stored[prop]; ok {
+			found[prop] = append([]string(nil), values...)
+		}
+	}
+	return found, nil
+}
+
+// Store implements sasl.UserStore. A user left without properties is
+// removed.
+func (ms *MemoryStore) Store(ctx context.Context, user, realm string,
+	props map[string][]string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := user + "@" + realm
+	stored, ok := ms.users[key]
+	if !ok {
+		stored = make(map[string][]string)
+		ms.users[key] = stored
+	}
+	for prop, values := range props {
+		if len(values) == 0 {
+			delete(stored, prop)
+			continue
+		}
+		stored[prop] = append([]string(nil), values...)
+	}
+	if len(stored) == 0 {
+		delete(ms.users, key)
+	}
+	return nil
+}
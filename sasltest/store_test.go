@@ -0,0 +1,75 @@
+package sasltest
+
+import (
+	"context"
+	"testing"
+
+	sasl "gopkg.in/freddierice/go-sasl.v4"
+)
+
+// TestMemoryStore authenticates against a MemoryStore with every mechanism
+// that checks passwords.
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(t, users)
+
+	mechs := []string{"PLAIN", "LOGIN", "CRAM-MD5", "DIGEST-MD5",
+		"SCRAM-SHA-1", "SCRAM-SHA-256"}
+	for _, mech := range mechs {
+		t.Run(mech, func(t *testing.T) {
+			ss := NewServer(t, store, nil)
+			cl := NewTestClient(t, &sasl.Config{
+				Username: "alice",
+				Password: "secret",
+			})
+			if _, err := Handshake(cl, ss, []string{mech}); err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+
+			ss = NewServer(t, store, nil)
+			cl = NewTestClient(t, &sasl.Config{
+				Username: "alice",
+				Password: "wrong",
+			})
+			_, err := Handshake(cl, ss, []string{mech})
+			if !sasl.IsAuthFailure(err) {
+				t.Errorf("expected an auth failure, got %v", err)
+			}
+		})
+	}
+}
+
+// TestMemoryStoreSetPassword changes passwords and reads properties kept in
+// a MemoryStore.
+func TestMemoryStoreSetPassword(t *testing.T) {
+	store := NewMemoryStore(t, nil)
+
+	ss := NewServer(t, store, nil)
+	if err := ss.SetPassword("bob", "", "pass", sasl.SetPassCreate); err != nil {
+		t.Fatalf("could not create bob: %v", err)
+	}
+	if exists, err := ss.UserExists("bob"); err != nil || !exists {
+		t.Errorf("expected bob, got %v, %v", exists, err)
+	}
+	if exists, err := ss.UserExists("carol"); err != nil || exists {
+		t.Errorf("expected no carol, got %v, %v", exists, err)
+	}
+	store.Store(context.Background(), "bob", Host, map[string][]string{
+		"mail": {"bob@example.com", "b@example.com"},
+	})
+
+	ss = NewServer(t, store, nil)
+	if err := ss.RequestProps("mail"); err != nil {
+		t.Fatalf("could not request props: %v", err)
+	}
+	cl := NewTestClient(t, &sasl.Config{Username: "bob", Password: "pass"})
+	if _, err := Handshake(cl, ss, []string{"SCRAM-SHA-256"}); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	props, err := ss.Props()
+	if err != nil {
+		t.Fatalf("could not get props: %v", err)
+	}
+	if mail := props["mail"]; len(mail) != 2 || mail[0] != "bob@example.com" {
+		t.Errorf("unexpected props %v", props)
+	}
+}
@@ -3,32 +3,83 @@ package sasl
 // #cgo LDFLAGS: -lsasl2
 // #cgo CFLAGS: -Wall
 // #include <sasl/sasl.h>
+// #include <stdint.h>
 // #include <stdio.h>
 // #include <stdlib.h>
 // #include <string.h>
 //
 // typedef struct SaslServer_struct {
-//     sasl_conn_t *ss_conn;
-//     char        *ss_service;
-//     char        *ss_hostname;
-//     char        *ss_realm;
+//     sasl_conn_t     *ss_conn;
+//     sasl_callback_t *ss_cbs;
+//     char            *ss_service;
+//     char            *ss_hostname;
+//     char            *ss_realm;
+//     char            **ss_options;
+//     uintptr_t       ss_log_handle;
+//     uintptr_t       ss_authorize_handle;
+//     uintptr_t       ss_canon_handle;
+//     sasl_channel_binding_t *ss_cbinding;
 // } SaslServer;
 //
 // void free_server(SaslServer *);
+// void free_options(char **opts);
+// void add_callback(sasl_callback_t* cbs, void *context, unsigned long id,
+//       int (*proc)(void));
+// int cb_getopt(char **opts, const char *plugin_name, const char *option,
+//       const char **result, unsigned *len);
+// int cb_log(void *context, int level, const char *message);
+// int cb_proxy_policy(sasl_conn_t *conn, void *context,
+//       const char *requested_user, unsigned rlen, const char *auth_identity,
+//       unsigned alen, const char *def_realm, unsigned urlen,
+//       struct propctx *propctx);
+// int cb_canon_user(sasl_conn_t *conn, void *context, const char *in,
+//       unsigned inlen, unsigned flags, const char *user_realm, char *out,
+//       unsigned out_max, unsigned *out_len);
+// void free_channel_binding(sasl_channel_binding_t *cb);
 //
-// SaslServer* new_server(char *service, char * hostname, char *realm) {
+// void generate_server_callbacks(SaslServer *ss) {
+//     sasl_callback_t *cbs = (sasl_callback_t *)malloc(
+//           sizeof(sasl_callback_t)*5);
+//     int cbiter = 0;
+//
+//     if( ss->ss_options )
+//         add_callback(cbs + cbiter++, (void *)ss->ss_options, SASL_CB_GETOPT,
+//           (int (*)(void))cb_getopt);
+//     if( ss->ss_log_handle )
+//         add_callback(cbs + cbiter++, (void *)ss->ss_log_handle, SASL_CB_LOG,
+//           (int (*)(void))cb_log);
+//     if( ss->ss_authorize_handle )
+//         add_callback(cbs + cbiter++, (void *)ss->ss_authorize_handle,
+//           SASL_CB_PROXY_POLICY, (int (*)(void))cb_proxy_policy);
+//     if( ss->ss_canon_handle )
+//         add_callback(cbs + cbiter++, (void *)ss->ss_canon_handle,
+//           SASL_CB_CANON_USER, (int (*)(void))cb_canon_user);
+//     add_callback(cbs + cbiter++, (void *)ss, SASL_CB_LIST_END, NULL);
+//
+//     ss->ss_cbs = cbs;
+// }
+//
+// SaslServer* new_server(char *service, char * hostname, char *realm,
+//       char **options, uintptr_t log_handle, uintptr_t authorize_handle,
+//       uintptr_t canon_handle, char *iplocalport, char *ipremoteport,
+//       int *res) {
 //     SaslServer *ret = (SaslServer *)malloc(sizeof(SaslServer));
-//     int res;
 //
 //     memset(ret, 0, sizeof(SaslServer));
 //
 //     ret->ss_service = service;
 //     ret->ss_hostname = hostname;
 //     ret->ss_realm = realm;
+//     ret->ss_options = options;
+//     ret->ss_log_handle = log_handle;
+//     ret->ss_authorize_handle = authorize_handle;
+//     ret->ss_canon_handle = canon_handle;
 //
-//     res = sasl_server_new(service, hostname, realm, NULL, NULL, NULL, 0,
-//             &ret->ss_conn);
-//     if( res != SASL_OK )
+//     generate_server_callbacks(ret);
+//
+//     *res = sasl_server_new(service, hostname, realm, iplocalport,
+//             ipremoteport, ret->ss_cbs, 0, &ret->ss_conn);
+//     if( *res != SASL_OK )
 //         goto cleanup;
 //
 //
@@ -44,50 +95,179 @@ package sasl
 //     if( ss->ss_service ) free( ss->ss_service );
 //     if( ss->ss_hostname ) free( ss->ss_hostname );
 //     if( ss->ss_realm ) free( ss->ss_realm );
+//     if( ss->ss_cbs ) free( ss->ss_cbs );
+//     free_options( ss->ss_options );
 //
 //     if( ss->ss_conn ) sasl_dispose( &ss->ss_conn );
+//     free_channel_binding( ss->ss_cbinding );
+//
+//     free( ss );
 // }
 import (
 	"C"
 )
 import (
-	"fmt"
-	"log"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"runtime/cgo"
 	"strings"
+	"sync"
+	"time"
 	"unsafe"
 )
 
-// Server holds the information necesary to keep state within the server
+// Server holds the information necesary to keep state within the server. It
+// is safe to use from multiple goroutines: calls into libsasl2 are
+// serialized. The callbacks of the ServerConfig run while Start, Step,
+// SetPassword, UserExists or CheckPassword is in progress, so they may only
+// call the State and Free methods of the server; other methods wait for the
+// call to return.
 type Server struct {
+	// mu guards the fields below and every use of the sasl connection but
+	// the calls that run callbacks, which run with busy set instead.
+	mu   sync.Mutex
+	busy chan struct{}
+
 	// libsaslwrapper
-	server        *C.struct_SaslServer_struct
-	handshakeDone bool
+	server          *C.struct_SaslServer_struct
+	logHandle       cgo.Handle
+	authorizeHandle cgo.Handle
+	canonHandle     cgo.Handle
+	channelBinding  *ChannelBinding
+	externalSSF     uint32
+	props           []**C.char
+	propNames       []string
+	state           State
+	completed       time.Time
 }
 
-// init starts the underlying sasl libraries so that plugins can be in place
-// before we create any servers.
-func init() {
-	result := C.sasl_server_init(nil, C.CString("CyrusSASL"))
-	if result != C.SASL_OK {
-		log.Fatalf("could not start libsasl2: %v\n", C.sasl_errstring(result, nil, nil))
-	}
+// ServerConfig is a struct that holds the information needed to initialize a
+// Server.
+type ServerConfig struct {
+	// Realm is the default user realm. If empty, it is derived from host.
+	Realm string
+
+	// Options are served to libsasl2 and its plugins through SASL_CB_GETOPT
+	// and take precedence over the <appname>.conf file, e.g. "mech_list",
+	// "pwcheck_method", "sasldb_path" or "auxprop_plugin".
+	Options map[string]string
+
+	// Logger receives the messages logged by libsasl2 for this server. If
+	// nil, Options.Logger passed to Init is used.
+	Logger *slog.Logger
+
+	// LocalAddr and RemoteAddr are the addresses of the connection to the
+	// client, e.g. conn.LocalAddr() and conn.RemoteAddr(). Some mechanisms,
+	// such as DIGEST-MD5, need them for their security layer.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// ChannelBinding binds the authentication to the TLS connection to the
+	// client. See NewChannelBinding and NewServerEndPointBinding.
+	ChannelBinding *ChannelBinding
+
+	// ExternalUsername and ExternalSsf describe an authentication that took
+	// place outside of SASL, e.g. with a TLS client certificate. They are
+	// used by the EXTERNAL mechanism. See SetTLSExternal.
+	ExternalUsername string
+	ExternalSsf      uint32
+
+	// Authorize decides whether a client may act as an authorization
+	// identity other than the one it authenticated as, e.g. for a proxy.
+	// If nil, such requests are refused (SASL_CB_PROXY_POLICY).
+	Authorize AuthorizeFunc
 
+	// Canonicalize, if set, maps the identities sent by the client before
+	// libsasl2 appends the user realm to names without one, looks them up
+	// and checks them (SASL_CB_CANON_USER).
+	Canonicalize CanonicalizeFunc
+
+	// MinSsf and MaxSsf bound the strength of the security layer, and
+	// MaxBufsize is the largest buffer the server accepts from Encode on
+	// the client. MaxSsf and MaxBufsize default to 65535.
+	MinSsf     uint32
+	MaxSsf     uint32
+	MaxBufsize uint32
 }
 
 // NewServer creates a server. Both service and host are necesary. Realm will
 // will be derived by host in this case.
 func NewServer(service, host, realm string) (*Server, error) {
-	ss := &Server{}
+	return NewServerWithConfig(service, host, &ServerConfig{Realm: realm})
+}
+
+// NewServerWithConfig creates a server from conf. Both service and host are
+// necesary. If conf is nil, then use defaults.
+func NewServerWithConfig(service, host string, conf *ServerConfig) (*Server,
+	error) {
+	if err := initialize(); err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		conf = &ServerConfig{}
+	}
+
+	ss := &Server{externalSSF: conf.ExternalSsf}
 
 	serviceStr := C.CString(service)
 	hostStr := C.CString(host)
 	realmStr := (*C.char)(unsafe.Pointer(nil))
-	if realm != "" {
-		realmStr = C.CString(realm)
+	if conf.Realm != "" {
+		realmStr = C.CString(conf.Realm)
+	}
+	localAddrStr := newAddr(conf.LocalAddr)
+	defer C.free(unsafe.Pointer(localAddrStr))
+	remoteAddrStr := newAddr(conf.RemoteAddr)
+	defer C.free(unsafe.Pointer(remoteAddrStr))
+	ss.logHandle = newLogHandle(conf.Logger)
+	if conf.Authorize != nil {
+		ss.authorizeHandle = cgo.NewHandle(conf.Authorize)
 	}
-	ss.server = C.new_server(serviceStr, hostStr, realmStr)
+	if conf.Canonicalize != nil {
+		ss.canonHandle = cgo.NewHandle(conf.Canonicalize)
+	}
+	var res C.int
+	ss.server = C.new_server(serviceStr, hostStr, realmStr,
+		newOptions(conf.Options), C.uintptr_t(ss.logHandle),
+		C.uintptr_t(ss.authorizeHandle), C.uintptr_t(ss.canonHandle),
+		localAddrStr, remoteAddrStr, &res)
 	if ss.server == nil {
-		return nil, fmt.Errorf("could not create the server")
+		ss.Free()
+		return nil, newError(nil, res, "NewServer")
+	}
+
+	maxSsf, maxBufsize := conf.MaxSsf, conf.MaxBufsize
+	if maxSsf == 0 {
+		maxSsf = 65535
+	}
+	if maxBufsize == 0 {
+		maxBufsize = 65535
+	}
+	err := setSecProps(ss.server.ss_conn, conf.MinSsf, maxSsf, maxBufsize)
+	if err != nil {
+		ss.Free()
+		return nil, err
+	}
+
+	if len(conf.ExternalUsername) > 0 {
+		err := setExternal(ss.server.ss_conn, conf.ExternalUsername,
+			conf.ExternalSsf)
+		if err != nil {
+			ss.Free()
+			return nil, err
+		}
+	}
+
+	if conf.ChannelBinding != nil {
+		ss.channelBinding = conf.ChannelBinding
+		ss.server.ss_cbinding = newChannelBinding(conf.ChannelBinding)
+		err := setChannelBinding(ss.server.ss_conn, ss.server.ss_cbinding)
+		if err != nil {
+			ss.Free()
+			return nil, err
+		}
 	}
 
 	return ss, nil
@@ -104,10 +284,16 @@ func (ss *Server) ListMech() ([]string, error) {
 	suffixStr := C.CString("")
 	defer C.free(unsafe.Pointer(suffixStr))
 
-	res := C.sasl_listmech(ss.server.ss_conn, nil, prefixStr, sepStr, suffixStr,
+	conn, err := ss.lock("ListMech")
+	if err != nil {
+		return nil, err
+	}
+	defer ss.mu.Unlock()
+
+	res := C.sasl_listmech(conn, nil, prefixStr, sepStr, suffixStr,
 		&retstr, nil, nil)
 	if res != C.SASL_OK {
-		return nil, ss.newError(res, "ListMech")
+		return nil, newError(conn, res, "ListMech")
 	}
 
 	sep := C.GoString(retstr)
@@ -118,30 +304,41 @@ func (ss *Server) ListMech() ([]string, error) {
 
 // Start initialtes the handshake between the server and client, where mech is
 // the agreed upon mechanism and challenge is the first set of bytes sent from
-// the client to the server. If done is true, the handshake is complete.
+// the client to the server, or nil if the client sent no initial response.
+// If done is true, the handshake is complete, and response holds any
+// additional data the client must be sent with the outcome.
 func (ss *Server) Start(mech string, challenge []byte) (response []byte,
 	done bool, err error) {
+	return ss.StartContext(context.Background(), mech, challenge)
+}
 
-	var responseStr *C.char
-	var responseLen C.uint
+// StartContext is like Start, but if ctx is done before libsasl2 returns,
+// the server is aborted: an error wrapping ErrAborted is returned and the
+// connection state is disposed as soon as libsasl2 returns.
+func (ss *Server) StartContext(ctx context.Context, mech string,
+	challenge []byte) (response []byte, done bool, err error) {
 
-	challengeStr := C.CString(string(challenge))
-	challengeLen := C.uint(len(challenge))
-	mechStr := C.CString(mech)
+	if _, err := ss.lock("Start", StateNew); err != nil {
+		return nil, false, err
+	}
+	defer ss.mu.Unlock()
 
-	res := C.sasl_server_start(ss.server.ss_conn, mechStr, challengeStr,
-		challengeLen, &responseStr, &responseLen)
-	if res != C.SASL_OK || res != C.SASL_CONTINUE {
-		return nil, false, ss.newError(res, "Start")
-	} else if res == C.SASL_OK {
-		ss.handshakeDone = true
+	if err := checkChannelBinding(ss.channelBinding, mech, "Start"); err != nil {
+		return nil, false, ss.transition(stepResult{err: err})
 	}
 
-	C.free(unsafe.Pointer(challengeStr))
-	C.free(unsafe.Pointer(mechStr))
+	var r stepResult
+	err = ss.run(ctx, "Start", func(conn *C.struct_sasl_conn) {
+		r = serverStart(conn, mech, challenge)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ss.transition(r); err != nil {
+		return nil, false, err
+	}
 
-	response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
-	return response, ss.handshakeDone, nil
+	return r.response, r.done, nil
 }
 
 // Step takes another step in the handshake between the server and client,
@@ -150,60 +347,302 @@ func (ss *Server) Start(mech string, challenge []byte) (response []byte,
 // is complete.
 func (ss *Server) Step(challenge []byte) (response []byte, done bool,
 	err error) {
+	return ss.StepContext(context.Background(), challenge)
+}
+
+// StepContext is like Step, but if ctx is done before libsasl2 returns, the
+// server is aborted like in StartContext.
+func (ss *Server) StepContext(ctx context.Context, challenge []byte) (
+	response []byte, done bool, err error) {
+
+	if _, err := ss.lock("Step", StateNegotiating); err != nil {
+		return nil, false, err
+	}
+	defer ss.mu.Unlock()
+
+	var r stepResult
+	err = ss.run(ctx, "Step", func(conn *C.struct_sasl_conn) {
+		r = serverStep(conn, challenge)
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ss.transition(r); err != nil {
+		return nil, false, err
+	}
+
+	return r.response, r.done, nil
+}
+
+// run calls fn with the connection of the server without holding ss.mu, so
+// that callbacks may call State and Free, as in runContext. ss.mu must be
+// held, and is held again when run returns. If the server was freed
+// meanwhile, its connection state is disposed and a *StateError is returned.
+// Callbacks made by fn get ctx from connContext.
+func (ss *Server) run(ctx context.Context, op string,
+	fn func(conn *C.struct_sasl_conn)) error {
+	// the server may be aborted while libsasl2 runs, so conn is passed on
+	conn := ss.server.ss_conn
+	busy := make(chan struct{})
+	ss.busy = busy
+	ss.mu.Unlock()
+
+	err := runContext(ctx, op, func() {
+		withConnContext(ctx, conn, func() { fn(conn) })
+	}, ss.abort)
+
+	ss.mu.Lock()
+	ss.busy = nil
+	close(busy)
+	if err != nil {
+		return err
+	}
+	if ss.state == StateFreed {
+		ss.dispose()
+		return &StateError{Op: op, State: StateFreed}
+	}
+	return nil
+}
+
+// serverStart calls sasl_server_start on conn.
+func serverStart(conn *C.struct_sasl_conn, mech string,
+	challenge []byte) (r stepResult) {
+
+	var responseStr, challengeStr *C.char
+	var responseLen C.uint
+
+	// a nil challenge means the client sent no initial response, which
+	// differs from an empty one
+	if challenge != nil {
+		challengeStr = C.CString(string(challenge))
+		defer C.free(unsafe.Pointer(challengeStr))
+	}
+	challengeLen := C.uint(len(challenge))
+	mechStr := C.CString(mech)
+	defer C.free(unsafe.Pointer(mechStr))
+
+	res := C.sasl_server_start(conn, mechStr, challengeStr,
+		challengeLen, &responseStr, &responseLen)
+	if res != C.SASL_OK && res != C.SASL_CONTINUE {
+		r.err = newError(conn, res, "Start")
+		return r
+	}
+
+	r.response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
+	r.done = res == C.SASL_OK
+	return r
+}
 
+// serverStep calls sasl_server_step on conn.
+func serverStep(conn *C.struct_sasl_conn, challenge []byte) (r stepResult) {
 	var responseStr *C.char
 	var responseLen C.uint
 	challengeStr := C.CString(string(challenge))
 	challengeLen := C.uint(len(challenge))
 	defer C.free(unsafe.Pointer(challengeStr))
 
-	res := C.sasl_server_step(ss.server.ss_conn, challengeStr, challengeLen,
+	res := C.sasl_server_step(conn, challengeStr, challengeLen,
 		&responseStr, &responseLen)
 	if res != C.SASL_OK && res != C.SASL_CONTINUE {
-		return nil, false, ss.newError(res, "Step")
-	} else if res == C.SASL_OK {
-		ss.handshakeDone = true
+		r.err = newError(conn, res, "Step")
+		return r
+	}
+
+	r.response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
+	r.done = res == C.SASL_OK
+	return r
+}
+
+// lock locks the server, once the calls that run callbacks return, and
+// returns its connection. If the server is not in one of states, or has no
+// connection, it returns a *StateError and the server is left unlocked. An
+// empty list of states allows every state. A Server that was not created
+// with NewServer is treated as freed.
+func (ss *Server) lock(op string, states ...State) (*C.struct_sasl_conn,
+	error) {
+	ss.mu.Lock()
+	for ss.busy != nil {
+		busy := ss.busy
+		ss.mu.Unlock()
+		<-busy
+		ss.mu.Lock()
+	}
+	if ss.server == nil || !allowed(ss.state, states) {
+		err := &StateError{Op: op, State: ss.state}
+		if ss.server == nil && ss.state == StateNew {
+			err.State = StateFreed
+		}
+		ss.mu.Unlock()
+		return nil, err
+	}
+	return ss.server.ss_conn, nil
+}
+
+// check returns a *StateError if the server is not in one of states.
+func (ss *Server) check(op string, states ...State) error {
+	if _, err := ss.lock(op, states...); err != nil {
+		return err
 	}
+	ss.mu.Unlock()
+	return nil
+}
 
-	response = C.GoBytes(unsafe.Pointer(responseStr), C.int(responseLen))
-	return response, ss.handshakeDone, nil
+// transition moves the server to the state that follows the step result r,
+// and returns the error of r. ss.mu must be held.
+func (ss *Server) transition(r stepResult) error {
+	switch {
+	case r.err != nil:
+		ss.state = StateFailed
+	case r.done:
+		ss.state = StateAuthenticated
+		ss.completed = time.Now()
+	default:
+		ss.state = StateNegotiating
+	}
+	return r.err
+}
+
+// abort detaches the connection state from the server and disposes it once
+// done is closed.
+func (ss *Server) abort(done <-chan struct{}) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	server, logHandle, authorizeHandle, canonHandle, props := ss.server,
+		ss.logHandle, ss.authorizeHandle, ss.canonHandle, ss.props
+	ss.server, ss.logHandle, ss.authorizeHandle, ss.canonHandle = nil, 0, 0, 0
+	ss.props = nil
+	if ss.state != StateFreed {
+		ss.state = StateFailed
+	}
+
+	whenDone(done, func() {
+		C.free_server(server)
+		freeLogHandle(logHandle)
+		freeHandle(authorizeHandle)
+		freeHandle(canonHandle)
+		freeProps(props)
+	})
 }
 
 // Encode takes in a byteslice of data, then produces its encoded form to be
 // sent to a client.
 func (ss *Server) Encode(buf []byte) ([]byte, error) {
-	return encode(ss.server.ss_conn, buf)
+	conn, err := ss.lock("Encode", StateAuthenticated)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.mu.Unlock()
+
+	return encode(conn, buf)
 }
 
 // Decode takes in a byteslice of data, then produces its encoded form to be
 // sent to a client.
 func (ss *Server) Decode(buf []byte) ([]byte, error) {
-	return decode(ss.server.ss_conn, buf)
+	conn, err := ss.lock("Decode", StateAuthenticated)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.mu.Unlock()
+
+	return decode(conn, buf)
+}
+
+// Wrap encode/decodes data over the supplied reader. This can only be called
+// after a SASL handshake has completed.
+func (ss *Server) Wrap(rw io.ReadWriter) (io.ReadWriter, error) {
+	if err := ss.check("Wrap", StateAuthenticated); err != nil {
+		return nil, err
+	}
+
+	return WrapReadWriter(ss, rw), nil
+}
+
+// WrapReader decodes data over the supplied reader. This can only be called
+// after a SASL handshake has completed.
+func (ss *Server) WrapReader(r io.Reader) (io.Reader, error) {
+	if err := ss.check("WrapReader", StateAuthenticated); err != nil {
+		return nil, err
+	}
+
+	return WrapReader(ss, r), nil
 }
 
-// GetUsername gets the username property from the sasl connection.
+// WrapWriter encodes data over the supplied writer. This can only be called
+// after a SASL handshake has completed.
+func (ss *Server) WrapWriter(w io.Writer) (io.Writer, error) {
+	if err := ss.check("WrapWriter", StateAuthenticated); err != nil {
+		return nil, err
+	}
+
+	return WrapWriter(ss, w), nil
+}
+
+// GetUsername gets the authorization identity (SASL_USERNAME), the user the
+// client acts as. See GetAuthUser for the identity whose credentials were
+// checked.
 func (ss *Server) GetUsername() (string, error) {
-	return getUsername(ss.server.ss_conn)
+	return ss.getString(C.SASL_USERNAME)
 }
 
 // GetSSF gets the security strength factor. If 0, then Encode/Decode are
 // unnecesary.
 func (ss *Server) GetSSF() (int, error) {
-	ssfUint, err := getSSF(ss.server.ss_conn)
+	ssfUint, err := ss.getUint(C.SASL_SSF)
 	return int(ssfUint), err
 }
 
-// Free cleans up allocated memory in the Server.
+// Free cleans up allocated memory in the Server. It waits for calls into
+// libsasl2 from other goroutines to return, but for those that run
+// callbacks: if they are in progress, e.g. when Free is called by a
+// callback, the connection is disposed once they return, and they fail with
+// ErrFreed.
 func (ss *Server) Free() {
-	if ss.server == nil {
-		return
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.state = StateFreed
+	if ss.busy == nil {
+		ss.dispose()
 	}
+}
 
-	C.free_server(ss.server)
-	ss.server = nil
+// dispose frees the connection state of the server. ss.mu must be held.
+func (ss *Server) dispose() {
+	if ss.server != nil {
+		C.free_server(ss.server)
+		ss.server = nil
+	}
+	freeLogHandle(ss.logHandle)
+	ss.logHandle = 0
+	freeHandle(ss.authorizeHandle)
+	ss.authorizeHandle = 0
+	freeHandle(ss.canonHandle)
+	ss.canonHandle = 0
+	freeProps(ss.props)
+	ss.props = nil
+}
+
+// Result summarizes the completed handshake. It is only valid in
+// StateAuthenticated.
+func (ss *Server) Result() (*AuthResult, error) {
+	conn, err := ss.lock("Result", StateAuthenticated)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.mu.Unlock()
+
+	// the default realm is unset if neither the config nor SetDefUserRealm
+	// provided one
+	realm, _ := getPropString(conn, C.SASL_DEFUSERREALM)
+	return newResult(conn, realm, ss.externalSSF, ss.completed)
 }
 
-// newError creates an error based on sasl_errstring / sasl_errdetail.
-func (ss *Server) newError(res C.int, msg string) error {
-	return newError(ss.server.ss_conn, res, msg)
+// State returns the stage of the handshake the server is in.
+func (ss *Server) State() State {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	return ss.state
 }
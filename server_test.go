@@ -0,0 +1,44 @@
+package sasl
+
+import "testing"
+
+// NewTestServer creates a new server for easy testing.
+func NewTestServer(t *testing.T, conf *ServerConfig) *Server {
+	ss, err := NewServerWithConfig("service", "hostname", conf)
+	if err != nil {
+		t.Fatalf("could not create server\n%v", err)
+	}
+
+	return ss
+}
+
+// TestServerNewAndFree creates and frees a server.
+func TestServerNewAndFree(t *testing.T) {
+	ss := NewTestServer(t, nil)
+	ss.Free()
+	ss.Free()
+
+	ss, err := NewServer("service", "hostname", "realm")
+	if err != nil {
+		t.Fatalf("could not create server\n%v", err)
+	}
+	ss.Free()
+}
+
+// TestServerOptions restricts the mechanisms of a server through its options.
+func TestServerOptions(t *testing.T) {
+	ss := NewTestServer(t, &ServerConfig{
+		Options: map[string]string{"mech_list": "PLAIN LOGIN"},
+	})
+	defer ss.Free()
+
+	mechs, err := ss.ListMech()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+	for _, mech := range mechs {
+		if mech != "PLAIN" && mech != "LOGIN" {
+			t.Errorf("unexpected mechanism %v in %v", mech, mechs)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/saslplug.h>
+// #include <sasl/prop.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// char **new_propnames(unsigned n);
+// void set_propname(char **names, unsigned i, char *name);
+// const struct propval *propval_at(const struct propval *vals, unsigned i);
+// const char *propval_value(const struct propval *val, unsigned i);
+//
+// int server_canon_user(sasl_server_params_t *sparams, char *user,
+//       unsigned ulen, unsigned flags, sasl_out_params_t *oparams) {
+//     return sparams->canon_user(sparams->utils->conn, user, ulen, flags,
+//           oparams);
+// }
+//
+// int server_checkpass(sasl_server_params_t *sparams, char *user,
+//       unsigned ulen, char *pass, unsigned passlen) {
+//     return sparams->utils->checkpass(sparams->utils->conn, user, ulen, pass,
+//           passlen);
+// }
+import "C"
+import (
+	"context"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// ServerMechanism is a mechanism implemented in Go that a Server advertises
+// and negotiates like those of the installed plugins. See
+// RegisterServerMechanism.
+type ServerMechanism interface {
+	// NewExchange begins an authentication described by params.
+	NewExchange(params *ServerParams) (ServerExchange, error)
+}
+
+// ServerExchange is a single authentication with a ServerMechanism.
+type ServerExchange interface {
+	// Step returns the challenge to response. The first step gets the
+	// initial response of the client, nil if there is none. done reports
+	// that the client is authenticated, its identities must have been set
+	// with ServerParams.SetIdentities; challenge is then sent to the client
+	// with the outcome. An *Error selects the result code returned by Start
+	// or Step, any other error is SASL_FAIL. ctx is the context passed to
+	// StartContext or StepContext, or context.Background().
+	Step(ctx context.Context, response []byte) (challenge []byte, done bool,
+		err error)
+}
+
+// ServerParams describes the connection of a ServerExchange and gives it
+// access to the utilities of libsasl2. The methods may only be called from
+// ServerMechanism.NewExchange and ServerExchange.Step.
+type ServerParams struct {
+	Service    string
+	ServerFQDN string
+
+	// UserRealm is the realm of the users of the server, if any.
+	UserRealm string
+
+	// LocalAddr and RemoteAddr are the "ip;port" addresses set by
+	// ServerConfig.LocalAddr and ServerConfig.RemoteAddr, if any.
+	LocalAddr  string
+	RemoteAddr string
+
+	ExternalSSF uint
+
+	sparams *C.sasl_server_params_t
+	oparams *C.sasl_out_params_t
+
+	// propNames are the names passed to prop_request, which does not copy
+	// them.
+	propNames []*C.char
+	requested []string
+}
+
+// RequestProps asks the auxiliary property plugins to look up names when
+// the identities are set. Names starting with "*" are looked up for the
+// authentication identity, the others for the authorization identity.
+func (sp *ServerParams) RequestProps(names ...string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	namesStr := C.new_propnames(C.uint(len(names)))
+	defer C.free(unsafe.Pointer(namesStr))
+	for i, name := range names {
+		nameStr := C.CString(name)
+		sp.propNames = append(sp.propNames, nameStr)
+		C.set_propname(namesStr, C.uint(i), nameStr)
+	}
+
+	res := C.prop_request(sp.sparams.propctx, (**C.char)(namesStr))
+	if res != C.SASL_OK {
+		return newError(sp.sparams.utils.conn, res, "RequestProps")
+	}
+	sp.requested = append(sp.requested, names...)
+	return nil
+}
+
+// Props returns the values of the properties requested with RequestProps
+// that were found once the identities were set.
+func (sp *ServerParams) Props() map[string][]string {
+	requested := make(map[string]bool, len(sp.requested))
+	for _, name := range sp.requested {
+		requested[name] = true
+	}
+
+	props := make(map[string][]string)
+	vals := C.prop_get(sp.sparams.propctx)
+	for i := C.uint(0); ; i++ {
+		val := C.propval_at(vals, i)
+		if val.name == nil {
+			break
+		}
+		name := C.GoString(val.name)
+		if !requested[name] || val.values == nil {
+			continue
+		}
+		for j := C.uint(0); j < val.nvalues; j++ {
+			props[name] = append(props[name],
+				C.GoString(C.propval_value(val, j)))
+		}
+	}
+	return props
+}
+
+// SetIdentities canonicalizes the authentication identity authnID and the
+// authorization identity authzID, which defaults to authnID, and looks up
+// the requested properties. It may only be called from Step. Once the
+// exchange is done, libsasl2 checks that authnID may act as authzID.
+func (sp *ServerParams) SetIdentities(authnID, authzID string) error {
+	if sp.oparams == nil {
+		return newError(sp.sparams.utils.conn, C.SASL_BADPARAM,
+			"SetIdentities")
+	}
+	if authzID == "" {
+		authzID = authnID
+	}
+
+	authzIDStr := C.CString(authzID)
+	defer C.free(unsafe.Pointer(authzIDStr))
+	res := C.server_canon_user(sp.sparams, authzIDStr, C.uint(len(authzID)),
+		C.SASL_CU_AUTHZID, sp.oparams)
+	if res != C.SASL_OK {
+		return newError(sp.sparams.utils.conn, res, "SetIdentities")
+	}
+
+	authnIDStr := C.CString(authnID)
+	defer C.free(unsafe.Pointer(authnIDStr))
+	res = C.server_canon_user(sp.sparams, authnIDStr, C.uint(len(authnID)),
+		C.SASL_CU_AUTHID, sp.oparams)
+	if res != C.SASL_OK {
+		return newError(sp.sparams.utils.conn, res, "SetIdentities")
+	}
+	return nil
+}
+
+// CheckPassword checks pass against the stored password of user with the
+// "pwcheck_method" of the server.
+func (sp *ServerParams) CheckPassword(user, pass string) error {
+	userStr := C.CString(user)
+	defer C.free(unsafe.Pointer(userStr))
+	passStr := C.CString(pass)
+	defer C.free(unsafe.Pointer(passStr))
+
+	res := C.server_checkpass(sp.sparams, userStr, C.uint(len(user)),
+		passStr, C.uint(len(pass)))
+	if res != C.SASL_OK {
+		return newError(sp.sparams.utils.conn, res, "CheckPassword")
+	}
+	return nil
+}
+
+// serverMechs holds the mechanisms passed to RegisterServerMechanism.
+var serverMechs = newRegistry("server mechanism", "RegisterServerMechanism",
+	addMech[ServerMechanism](true))
+
+// RegisterServerMechanism registers mech as the server side of the
+// mechanism info.Name, provided by the plugin info.Plugin, which defaults to
+// the name of the mechanism. Mechanisms implemented in Go have no security
+// layer, so info.MaxSSF must be 0.
+func RegisterServerMechanism(info MechanismInfo, mech ServerMechanism) error {
+	if info.MaxSSF != 0 {
+		return newError(nil, C.SASL_BADPARAM, "RegisterServerMechanism")
+	}
+	if info.Plugin == "" {
+		info.Plugin = info.Name
+	}
+	return serverMechs.register(info.Name,
+		registeredMech[ServerMechanism]{info: info, mech: mech})
+}
+
+// serverExchange is the connection context of a mechanism registered with
+// RegisterServerMechanism.
+type serverExchange struct {
+	exchange ServerExchange
+	params   ServerParams
+
+	// out is the last challenge, libsasl2 does not copy it.
+	out *C.char
+}
+
+// serverMechNew begins an exchange with the mechanism registered as name,
+// and returns a handle to its state.
+func serverMechNew(name string, sparams *C.sasl_server_params_t) (
+	cgo.Handle, C.int) {
+	m, ok := serverMechs.get(name)
+	if !ok {
+		return 0, C.SASL_NOMECH
+	}
+
+	se := &serverExchange{params: ServerParams{
+		Service:     C.GoString(sparams.service),
+		ServerFQDN:  C.GoString(sparams.serverFQDN),
+		UserRealm:   C.GoString(sparams.user_realm),
+		LocalAddr:   C.GoString(sparams.iplocalport),
+		RemoteAddr:  C.GoString(sparams.ipremoteport),
+		ExternalSSF: uint(sparams.external_ssf),
+		sparams:     sparams,
+	}}
+	exchange, err := m.mech.NewExchange(&se.params)
+	if err != nil {
+		freeExchangeProps(&se.params)
+		return 0, reportError(sparams.utils.conn, err, C.SASL_FAIL)
+	}
+	se.exchange = exchange
+	return cgo.NewHandle(se), C.SASL_OK
+}
+
+// serverMechStep runs a step of the exchange of handle.
+func serverMechStep(handle cgo.Handle, sparams *C.sasl_server_params_t,
+	response []byte, serverout **C.char, serveroutlen *C.uint,
+	oparams *C.sasl_out_params_t) C.int {
+	se := handle.Value().(*serverExchange)
+
+	se.params.sparams = sparams
+	se.params.oparams = oparams
+	challenge, done, err := se.exchange.Step(connContext(sparams.utils.conn),
+		response)
+	se.params.oparams = nil
+	if err != nil {
+		return reportError(sparams.utils.conn, err, C.SASL_FAIL)
+	}
+
+	C.free(unsafe.Pointer(se.out))
+	se.out = nil
+	if challenge != nil {
+		se.out = C.CString(string(challenge))
+	}
+	*serverout = se.out
+	*serveroutlen = C.uint(len(challenge))
+	if !done {
+		return C.SASL_CONTINUE
+	}
+
+	oparams.doneflag = 1
+	oparams.mech_ssf = 0
+	oparams.encode = nil
+	oparams.decode = nil
+	return C.SASL_OK
+}
+
+// dispose frees the last challenge and the requested property names.
+func (se *serverExchange) dispose() {
+	C.free(unsafe.Pointer(se.out))
+	freeExchangeProps(&se.params)
+}
+
+// freeExchangeProps frees the property names requested by an exchange. The
+// mechanism must have been disposed.
+func freeExchangeProps(sp *ServerParams) {
+	for _, name := range sp.propNames {
+		C.free(unsafe.Pointer(name))
+	}
+	sp.propNames = nil
+}
@@ -0,0 +1,184 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testServerMechanism is the server side of testMechanism. It checks the
+// password against the "*userPassword" property of the user. Like the
+// client, it answers "wait" with the error of ctx once it is done.
+type testServerMechanism struct{}
+
+// NewExchange implements ServerMechanism.
+func (testServerMechanism) NewExchange(params *ServerParams) (
+	ServerExchange, error) {
+	return &testServerExchange{params: params}, nil
+}
+
+// testServerExchange is an exchange of testServerMechanism.
+type testServerExchange struct {
+	params *ServerParams
+	user   string
+}
+
+// Step implements ServerExchange.
+func (te *testServerExchange) Step(ctx context.Context, response []byte) (
+	[]byte, bool, error) {
+	if string(response) == "wait" {
+		<-ctx.Done()
+		waitedSteps <- ctx.Err()
+		return nil, false, ctx.Err()
+	}
+	if te.user == "" {
+		te.user = string(response)
+		if err := te.params.RequestProps("*userPassword"); err != nil {
+			return nil, false, err
+		}
+		if err := te.params.SetIdentities(te.user, ""); err != nil {
+			return nil, false, err
+		}
+		return []byte("nonce"), false, nil
+	}
+
+	pass, ok := strings.CutSuffix(string(response), ":nonce")
+	stored := te.params.Props()["*userPassword"]
+	if !ok || len(stored) != 1 || stored[0] != pass {
+		return nil, false, ErrBadAuth
+	}
+	if err := te.params.CheckPassword(te.user, pass); err != nil {
+		return nil, false, err
+	}
+	return nil, true, nil
+}
+
+// NewMechServer creates a server that checks passwords of X-GO-TEST. If
+// conf is not nil, the server is configured with it.
+func NewMechServer(t *testing.T, conf *ServerConfig) *Server {
+	RegisterTestMechanisms(t)
+	if conf == nil {
+		conf = &ServerConfig{}
+	}
+	conf.Options = map[string]string{
+		"auxprop_plugin": "gosasltest",
+		"pwcheck_method": "auxprop",
+	}
+	return NewTestServer(t, conf)
+}
+
+// mechHandshake authenticates cl with ss using X-GO-TEST.
+func mechHandshake(cl *Client, ss *Server) error {
+	mech, response, _, err := cl.Start([]string{"X-GO-TEST"})
+	if err != nil {
+		return err
+	}
+	challenge, done, err := ss.Start(mech, response)
+	for err == nil && !done {
+		response, _, err = cl.Step(challenge)
+		if err != nil {
+			return err
+		}
+		challenge, done, err = ss.Step(response)
+	}
+	return err
+}
+
+// TestServerMechanism negotiates a mechanism implemented in Go on both
+// sides.
+func TestServerMechanism(t *testing.T) {
+	ss := NewMechServer(t, nil)
+	defer ss.Free()
+
+	mechs, err := ss.ListMech()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+	if !slices.Contains(mechs, "X-GO-TEST") {
+		t.Errorf("X-GO-TEST is not advertised in %v", mechs)
+	}
+	infos, err := ListServerMechanisms()
+	if err != nil {
+		t.Fatalf("could not list mechanisms: %v", err)
+	}
+	if !slices.ContainsFunc(infos, func(mi MechanismInfo) bool {
+		return mi.Name == "X-GO-TEST" && mi.Plugin == "gosasltest"
+	}) {
+		t.Errorf("X-GO-TEST is not listed in %v", infos)
+	}
+
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "alice",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+	if err := mechHandshake(cl, ss); err != nil {
+		t.Fatalf("handshake failed: %v", err)
+	}
+	r, err := ss.Result()
+	if err != nil {
+		t.Fatalf("could not get the result: %v", err)
+	}
+	if r.Mechanism != "X-GO-TEST" || r.AuthnID != "alice" ||
+		r.AuthzID != "alice" {
+		t.Errorf("unexpected result %+v", r)
+	}
+
+	err = RegisterServerMechanism(testMechanismInfo, testServerMechanism{})
+	if !errors.Is(err, ErrRegistered) {
+		t.Errorf("expected ErrRegistered, got %v", err)
+	}
+}
+
+// TestServerMechanismBadPassword checks that the error of a step is
+// returned by the server.
+func TestServerMechanismBadPassword(t *testing.T) {
+	ss := NewMechServer(t, nil)
+	defer ss.Free()
+
+	cl, err := NewClient("service", "hostname", &Config{
+		Username: "alice",
+		Password: "wrong",
+	})
+	if err != nil {
+		t.Fatalf("could not create client: %v", err)
+	}
+	defer cl.Free()
+	if err := mechHandshake(cl, ss); !errors.Is(err, ErrBadAuth) {
+		t.Errorf("expected ErrBadAuth, got %v", err)
+	}
+	if state := ss.State(); state != StateFailed {
+		t.Errorf("expected state failed, got %v", state)
+	}
+}
+
+// TestServerMechanismContext aborts a step of a mechanism implemented in Go,
+// which sees the context of the step.
+func TestServerMechanismContext(t *testing.T) {
+	ss := NewMechServer(t, nil)
+	defer ss.Free()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	_, _, err := ss.StartContext(ctx, "X-GO-TEST", []byte("wait"))
+	if !errors.Is(err, ErrAborted) ||
+		!errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an aborted start, got %v", err)
+	}
+
+	select {
+	case err := <-waitedSteps:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the step to see the deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the step did not see the end of the handshake")
+	}
+}
@@ -0,0 +1,39 @@
+package sasl
+
+import (
+	"io"
+
+	"gopkg.in/freddierice/go-sasl.v4/session"
+)
+
+// Wrapable is session.Wrapable.
+type Wrapable = session.Wrapable
+
+// Wrapper is session.Wrapper.
+type Wrapper = session.Wrapper
+
+// ClientSession is session.ClientSession, implemented by *Client.
+type ClientSession = session.ClientSession
+
+// ServerSession is session.ServerSession, implemented by *Server.
+type ServerSession = session.ServerSession
+
+// WrapReadWriter calls session.WrapReadWriter.
+func WrapReadWriter(wrapable Wrapable, readwriter io.ReadWriter) io.ReadWriter {
+	return session.WrapReadWriter(wrapable, readwriter)
+}
+
+// WrapReader calls session.WrapReader.
+func WrapReader(wrapable Wrapable, reader io.Reader) io.Reader {
+	return session.WrapReader(wrapable, reader)
+}
+
+// WrapWriter calls session.WrapWriter.
+func WrapWriter(wrapable Wrapable, writer io.Writer) io.Writer {
+	return session.WrapWriter(wrapable, writer)
+}
+
+var (
+	_ ClientSession = (*Client)(nil)
+	_ ServerSession = (*Server)(nil)
+)
@@ -0,0 +1,6 @@
+// Package session holds the types of package sasl that do not depend on
+// libsasl2: its errors, the states and results of a handshake, the security
+// layer wrappers and the interfaces of clients and servers. Code that only
+// uses them builds without cgo. Package sasl re-exports everything defined
+// here.
+package session
@@ -0,0 +1,92 @@
+package session
+
+import "errors"
+
+// Error is the error returned whenever a call into libsasl2 does not succeed.
+// Op is the name of the operation that failed, Code is the SASL_* result code
+// and Detail is the message provided by sasl_errdetail or sasl_errstring.
+type Error struct {
+	Op     string
+	Code   int
+	Detail string
+}
+
+// Sentinel errors for every SASL_* failure code. They can be used with
+// errors.Is to classify an error returned by package sasl, e.g.
+// errors.Is(err, sasl.ErrBadAuth). Their details are those of
+// sasl_errstring.
+var (
+	ErrFail             = sentinel(-1, "generic failure")
+	ErrNoMem            = sentinel(-2, "no memory available")
+	ErrBufOver          = sentinel(-3, "overflowed buffer")
+	ErrNoMech           = sentinel(-4, "no mechanism available")
+	ErrBadProt          = sentinel(-5, "bad protocol / cancel")
+	ErrNotDone          = sentinel(-6, "can't request information until later in exchange")
+	ErrBadParam         = sentinel(-7, "invalid parameter supplied")
+	ErrTryAgain         = sentinel(-8, "transient failure (e.g., weak key)")
+	ErrBadMAC           = sentinel(-9, "integrity check failed")
+	ErrBadServ          = sentinel(-10, "server failed mutual authentication step")
+	ErrWrongMech        = sentinel(-11, "mechanism doesn't support requested feature")
+	ErrNotInit          = sentinel(-12, "SASL library is not initialized")
+	ErrBadAuth          = sentinel(-13, "authentication failure")
+	ErrNoAuthz          = sentinel(-14, "authorization failure")
+	ErrTooWeak          = sentinel(-15, "mechanism too weak for this user")
+	ErrEncrypt          = sentinel(-16, "encryption needed to use mechanism")
+	ErrTrans            = sentinel(-17, "One time use of a plaintext password will enable requested mechanism for user")
+	ErrExpired          = sentinel(-18, "passphrase expired, has to be reset")
+	ErrDisabled         = sentinel(-19, "account disabled")
+	ErrNoUser           = sentinel(-20, "user not found")
+	ErrBadVers          = sentinel(-23, "version mismatch with plug-in")
+	ErrUnavail          = sentinel(-24, "remote authentication server unavailable")
+	ErrNoVerify         = sentinel(-26, "user exists, but no verifier for user")
+	ErrPwLock           = sentinel(-21, "passphrase locked")
+	ErrNoChange         = sentinel(-22, "requested change was not needed")
+	ErrWeakPass         = sentinel(-27, "passphrase is too weak for security policy")
+	ErrNoUserPass       = sentinel(-28, "user supplied passwords are not permitted")
+	ErrNeedOldPasswd    = sentinel(-29, "sasl_setpass needs old password in order to perform password change")
+	ErrConstraintViolat = sentinel(-30, "sasl_setpass can't store a property because of a constraint violation")
+	ErrBadBinding       = sentinel(-32, "channel binding failure")
+	ErrConfigErr        = sentinel(-100, "error when parsing configuration file")
+)
+
+// ErrFreed is returned when a client or server is used after Free.
+var ErrFreed = errors.New("sasl: use of a freed connection")
+
+// ErrAborted is returned when a handshake is abandoned because its context
+// was canceled or its deadline expired. The error also wraps ctx.Err(), so
+// errors.Is(err, context.DeadlineExceeded) can be used to tell them apart.
+var ErrAborted = errors.New("sasl: handshake aborted")
+
+// sentinel creates the canonical error for a result code.
+func sentinel(code int, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Op == "" {
+		return "sasl: " + e.Detail
+	}
+	return "sasl: " + e.Op + ": " + e.Detail
+}
+
+// Is reports whether target is an *Error with the same result code. This lets
+// errors.Is match an error against the sentinel values above.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// IsAuthFailure reports whether err means that the peer's credentials were
+// rejected, as opposed to a configuration or protocol problem.
+func IsAuthFailure(err error) bool {
+	return errors.Is(err, ErrBadAuth) || errors.Is(err, ErrNoAuthz) ||
+		errors.Is(err, ErrNoUser) || errors.Is(err, ErrExpired) ||
+		errors.Is(err, ErrDisabled) || errors.Is(err, ErrNoVerify)
+}
+
+// IsTemporary reports whether the operation that produced err may succeed if
+// it is retried later.
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrTryAgain) || errors.Is(err, ErrUnavail)
+}
@@ -0,0 +1,31 @@
+package session
+
+import "time"
+
+// AuthResult summarizes a completed handshake. It is meant to be logged, so
+// it never contains secrets.
+type AuthResult struct {
+	// Mechanism is the negotiated mechanism (SASL_MECHNAME).
+	Mechanism string `json:"mechanism"`
+	// AuthnID is the identity whose credentials were checked
+	// (SASL_AUTHUSER).
+	AuthnID string `json:"authn_id"`
+	// AuthzID is the identity the connection acts as (SASL_USERNAME). It
+	// equals AuthnID unless a proxy authorization was requested.
+	AuthzID string `json:"authz_id"`
+	// Realm is the realm the handshake used: the default user realm of a
+	// server (SASL_DEFUSERREALM), and the configured or chosen realm of a
+	// client. It is not derived from the identities, which may contain "@"
+	// without naming a realm.
+	Realm string `json:"realm,omitempty"`
+	// SSF is the strength of the negotiated security layer (SASL_SSF).
+	SSF uint `json:"ssf"`
+	// MaxOutBuf is the largest buffer that may be passed to Encode
+	// (SASL_MAXOUTBUF).
+	MaxOutBuf uint `json:"max_out_buf"`
+	// ExternalSSF is the strength of the external security layer, such as
+	// TLS, that the handshake was run over (SASL_SSF_EXTERNAL).
+	ExternalSSF uint `json:"external_ssf"`
+	// Completed is when the handshake completed.
+	Completed time.Time `json:"completed"`
+}
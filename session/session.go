@@ -0,0 +1,51 @@
+package session
+
+import (
+	"context"
+	"io"
+)
+
+// Wrapper is the security layer of an authenticated client or server.
+type Wrapper interface {
+	Wrapable
+	Wrap(rw io.ReadWriter) (io.ReadWriter, error)
+	WrapReader(r io.Reader) (io.Reader, error)
+	WrapWriter(w io.Writer) (io.Writer, error)
+	GetSSF() (int, error)
+}
+
+// ClientSession is the client side of an authentication. It is implemented
+// by *sasl.Client, and by the fakes of package sasltest/fake so that code
+// built on top of package sasl can be tested without libsasl2.
+type ClientSession interface {
+	Wrapper
+	Start(mechlist []string) (mech string, response []byte, done bool,
+		err error)
+	StartContext(ctx context.Context, mechlist []string) (mech string,
+		response []byte, done bool, err error)
+	Step(challenge []byte) (response []byte, done bool, err error)
+	StepContext(ctx context.Context, challenge []byte) (response []byte,
+		done bool, err error)
+	GetUsername() (string, error)
+	Result() (*AuthResult, error)
+	State() State
+	Free()
+}
+
+// ServerSession is the server side of an authentication. It is implemented
+// by *sasl.Server, and by the fakes of package sasltest/fake.
+type ServerSession interface {
+	Wrapper
+	ListMech() ([]string, error)
+	Start(mech string, challenge []byte) (response []byte, done bool,
+		err error)
+	StartContext(ctx context.Context, mech string, challenge []byte) (
+		response []byte, done bool, err error)
+	Step(challenge []byte) (response []byte, done bool, err error)
+	StepContext(ctx context.Context, challenge []byte) (response []byte,
+		done bool, err error)
+	GetUsername() (string, error)
+	Result() (*AuthResult, error)
+	State() State
+	Free()
+}
@@ -0,0 +1,67 @@
+package session
+
+import "fmt"
+
+// State is the stage of the handshake a client or server is in. The
+// transitions are:
+//
+//	New -> Negotiating -> Authenticated
+//	New or Negotiating -> Failed
+//	any state -> Freed
+//
+// Start is only valid in StateNew and Step only in StateNegotiating. Start
+// and Step move straight to StateAuthenticated when the handshake completes,
+// and to StateFailed when they return an error. Encode, Decode and the Wrap
+// methods are only valid in StateAuthenticated. Every method but Free and
+// State fails in StateFreed.
+type State int
+
+// States of a client or server.
+const (
+	StateNew State = iota
+	StateNegotiating
+	StateAuthenticated
+	StateFailed
+	StateFreed
+)
+
+// String implements fmt.Stringer.
+func (s State) String() string {
+	switch s {
+	case StateNew:
+		return "new"
+	case StateNegotiating:
+		return "negotiating"
+	case StateAuthenticated:
+		return "authenticated"
+	case StateFailed:
+		return "failed"
+	case StateFreed:
+		return "freed"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// StateError is returned when a method is called in a state that does not
+// allow it. It matches ErrFreed in StateFreed and ErrNotDone before the
+// handshake has completed.
+type StateError struct {
+	Op    string
+	State State
+}
+
+// Error implements the error interface.
+func (e *StateError) Error() string {
+	return fmt.Sprintf("sasl: %v: not allowed in state %v", e.Op, e.State)
+}
+
+// Is lets errors.Is match a StateError against ErrFreed and ErrNotDone.
+func (e *StateError) Is(target error) bool {
+	switch target {
+	case ErrFreed:
+		return e.State == StateFreed
+	case error(ErrNotDone):
+		return e.State == StateNew || e.State == StateNegotiating
+	}
+	return false
+}
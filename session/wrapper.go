@@ -0,0 +1,154 @@
+package session
+
+import "io"
+
+// Wrapable encodes and decodes the data of a security layer.
+type Wrapable interface {
+	Decode([]byte) ([]byte, error)
+	Encode([]byte) ([]byte, error)
+}
+
+// wrappedReader is a struct that holds the underlying sasl connection
+// and io.Reader.
+type wrappedReader struct {
+	wrap    Wrapable
+	r       io.Reader
+	pending []byte
+}
+
+// Read implements io.Reader.
+func (wr *wrappedReader) Read(buf []byte) (n int, err error) {
+	return read(buf, wr.wrap, wr.r, &wr.pending)
+}
+
+// wrappedWriter is a struct that holds the underlying sasl connection
+// and io.Writer.
+type wrappedWriter struct {
+	wrap Wrapable
+	w    io.Writer
+}
+
+// Write implements the io.Writer.
+func (ww *wrappedWriter) Write(buf []byte) (n int, err error) {
+	return write(buf, ww.wrap, ww.w)
+}
+
+// wrappedReadWriter is a struct that holds the underlying sasl connection
+// and io.ReadWriter.
+type wrappedReadWriter struct {
+	wrap    Wrapable
+	rw      io.ReadWriter
+	pending []byte
+}
+
+// Read implements io.ReadWriter.
+func (wrw *wrappedReadWriter) Read(buf []byte) (n int, err error) {
+	return read(buf, wrw.wrap, wrw.rw, &wrw.pending)
+}
+
+// Write implements io.ReadWriter.
+func (wrw *wrappedReadWriter) Write(buf []byte) (n int, err error) {
+	return write(buf, wrw.wrap, wrw.rw)
+}
+
+// WrapReadWriter creates a io.ReadWriter that encodes and decodes data sent
+// over a sasl connection.
+func WrapReadWriter(wrapable Wrapable, readwriter io.ReadWriter) io.ReadWriter {
+	return &wrappedReadWriter{
+		wrap: wrapable,
+		rw:   readwriter,
+	}
+}
+
+// WrapReader creates an io.Reader that decodes data from a sasl
+// server/client.
+func WrapReader(wrapable Wrapable, reader io.Reader) io.Reader {
+	return &wrappedReader{
+		wrap: wrapable,
+		r:    reader,
+	}
+}
+
+// WrapWriter creates an io.Writer that encodes data to a sasl server/client.
+func WrapWriter(wrapable Wrapable, writer io.Writer) io.Writer {
+	return &wrappedWriter{
+		wrap: wrapable,
+		w:    writer,
+	}
+}
+
+// readSize is the size of the reads from the underlying reader.
+const readSize = 4096
+
+// read reads from the underlying reader and decodes what it read into buf.
+// Decoded data that does not fit in buf is kept in pending for the next
+// read. A security layer may need several reads to decode a single packet.
+func read(buf []byte, wrap Wrapable, r io.Reader, pending *[]byte) (n int,
+	err error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	raw := make([]byte, readSize)
+	for len(*pending) == 0 {
+		n, err := r.Read(raw)
+		if n > 0 {
+			b, err := wrap.Decode(raw[:n])
+			if err != nil {
+				return 0, err
+			}
+			*pending = b
+		}
+		if err != nil {
+			// return what was decoded, the error is returned again by
+			// the next read
+			if len(*pending) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+
+	n = copy(buf, *pending)
+	*pending = (*pending)[n:]
+	return n, nil
+}
+
+// maxOutBuffer is implemented by Wrapables whose Encode takes a limited
+// amount of data, such as Client and Server (SASL_MAXOUTBUF).
+type maxOutBuffer interface {
+	GetMaxOutBuf() (uint, error)
+}
+
+// write encodes buf in chunks that Encode accepts and passes them along to
+// the underlying writer. n counts the bytes of buf whose encoded chunk was
+// written in full, so a short write of the first chunk returns 0.
+func write(buf []byte, wrap Wrapable, w io.Writer) (n int, err error) {
+	chunk := len(buf)
+	if m, ok := wrap.(maxOutBuffer); ok {
+		maxOutBuf, err := m.GetMaxOutBuf()
+		if err != nil {
+			return 0, err
+		}
+		if maxOutBuf > 0 && int(maxOutBuf) < chunk {
+			chunk = int(maxOutBuf)
+		}
+	}
+
+	for n < len(buf) {
+		end := min(n+chunk, len(buf))
+		b, err := wrap.Encode(buf[n:end])
+		if err != nil {
+			return n, err
+		}
+		written, err := w.Write(b)
+		if err == nil && written < len(b) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// framer is a Wrapable that prefixes each encoded chunk with its length,
+// and only encodes chunks of up to maxOutBuf bytes.
+type framer struct {
+	maxOutBuf uint
+	chunks    int
+}
+
+// Encode implements Wrapable.
+func (f *framer) Encode(buf []byte) ([]byte, error) {
+	if uint(len(buf)) > f.maxOutBuf {
+		return nil, ErrBadParam
+	}
+	f.chunks++
+	return append([]byte{byte(len(buf))}, buf...), nil
+}
+
+// Decode implements Wrapable.
+func (f *framer) Decode(buf []byte) ([]byte, error) {
+	var out []byte
+	for len(buf) > 0 {
+		n := int(buf[0]) + 1
+		out = append(out, buf[1:n]...)
+		buf = buf[n:]
+	}
+	return out, nil
+}
+
+// GetMaxOutBuf implements maxOutBuffer.
+func (f *framer) GetMaxOutBuf() (uint, error) {
+	return f.maxOutBuf, nil
+}
+
+// TestWrapWriter checks that writes count the bytes written, not the bytes
+// encoded, and are split into chunks Encode accepts.
+func TestWrapWriter(t *testing.T) {
+	f := &framer{maxOutBuf: 100}
+	var out bytes.Buffer
+	w := WrapWriter(f, &out)
+
+	message := strings.Repeat("data", 100)
+	n, err := w.Write([]byte(message))
+	if err != nil || n != len(message) {
+		t.Fatalf("expected %d bytes written, got %d: %v", len(message), n,
+			err)
+	}
+	if f.chunks != 4 {
+		t.Errorf("expected 4 chunks, got %d", f.chunks)
+	}
+
+	out.Reset()
+	copied, err := io.Copy(w, strings.NewReader(message))
+	if err != nil || copied != int64(len(message)) {
+		t.Fatalf("expected %d bytes copied, got %d: %v", len(message),
+			copied, err)
+	}
+	got, err := io.ReadAll(WrapReader(f, &out))
+	if err != nil {
+		t.Fatalf("could not read: %v", err)
+	}
+	if string(got) != message {
+		t.Errorf("read a different message")
+	}
+}
+
+// shortWriter writes at most n bytes in total.
+type shortWriter struct {
+	n int
+}
+
+func (sw *shortWriter) Write(b []byte) (int, error) {
+	n := min(len(b), sw.n)
+	sw.n -= n
+	return n, nil
+}
+
+// TestWrapWriterShort returns the bytes of the chunks written in full when
+// the underlying writer writes less.
+func TestWrapWriterShort(t *testing.T) {
+	w := WrapWriter(&framer{maxOutBuf: 4}, &shortWriter{n: 3})
+	n, err := w.Write([]byte("data"))
+	if n != 0 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("expected a short write of 0 bytes, got %d: %v", n, err)
+	}
+
+	w = WrapWriter(&framer{maxOutBuf: 2}, &shortWriter{n: 4})
+	n, err = w.Write([]byte("datadata"))
+	if n != 2 || !errors.Is(err, io.ErrShortWrite) {
+		t.Errorf("expected a short write of 2 bytes, got %d: %v", n, err)
+	}
+}
@@ -0,0 +1,32 @@
+package sasl
+
+import "gopkg.in/freddierice/go-sasl.v4/session"
+
+// State is session.State.
+type State = session.State
+
+// The states of package session.
+const (
+	StateNew           = session.StateNew
+	StateNegotiating   = session.StateNegotiating
+	StateAuthenticated = session.StateAuthenticated
+	StateFailed        = session.StateFailed
+	StateFreed         = session.StateFreed
+)
+
+// StateError is session.StateError.
+type StateError = session.StateError
+
+// allowed reports whether s is one of states. An empty list allows every
+// state.
+func allowed(s State, states []State) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, state := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
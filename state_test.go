@@ -0,0 +1,94 @@
+package sasl
+
+import (
+	"errors"
+	"testing"
+)
+
+// stateError asserts that err is a *StateError for op in state.
+func stateError(t *testing.T, err error, op string, state State) {
+	t.Helper()
+
+	var se *StateError
+	if !errors.As(err, &se) {
+		t.Fatalf("%v: expected a *StateError, got %v", op, err)
+	}
+	if se.Op != op || se.State != state {
+		t.Errorf("expected %v in state %v, got %v in state %v", op, state,
+			se.Op, se.State)
+	}
+}
+
+// TestClientStates walks a client through every state.
+func TestClientStates(t *testing.T) {
+	cl := NewPlainClient(t)
+
+	if state := cl.State(); state != StateNew {
+		t.Errorf("expected state new, got %v", state)
+	}
+	_, _, err := cl.Step(nil)
+	stateError(t, err, "Step", StateNew)
+
+	if _, _, _, err := cl.Start([]string{"PLAIN"}); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	if state := cl.State(); state != StateAuthenticated {
+		t.Errorf("expected state authenticated, got %v", state)
+	}
+	_, _, _, err = cl.Start([]string{"PLAIN"})
+	stateError(t, err, "Start", StateAuthenticated)
+
+	cl.Free()
+	if state := cl.State(); state != StateFreed {
+		t.Errorf("expected state freed, got %v", state)
+	}
+	_, err = cl.Encode([]byte("data"))
+	stateError(t, err, "Encode", StateFreed)
+	if !errors.Is(err, ErrFreed) {
+		t.Errorf("expected ErrFreed, got %v", err)
+	}
+}
+
+// TestClientFailed checks that a failed handshake cannot be continued.
+func TestClientFailed(t *testing.T) {
+	cl := NewPlainClient(t)
+	defer cl.Free()
+
+	if _, _, _, err := cl.Start([]string{"NOSUCHMECH"}); err == nil {
+		t.Fatalf("expected an unknown mechanism to fail")
+	}
+	if state := cl.State(); state != StateFailed {
+		t.Errorf("expected state failed, got %v", state)
+	}
+	_, _, err := cl.Step(nil)
+	stateError(t, err, "Step", StateFailed)
+}
+
+// TestServerStates checks the guards on a server that is not authenticated.
+func TestServerStates(t *testing.T) {
+	ss := NewTestServer(t, nil)
+
+	if state := ss.State(); state != StateNew {
+		t.Errorf("expected state new, got %v", state)
+	}
+	_, _, err := ss.Step(nil)
+	stateError(t, err, "Step", StateNew)
+	_, err = ss.Encode([]byte("data"))
+	stateError(t, err, "Encode", StateNew)
+	if !errors.Is(err, ErrNotDone) {
+		t.Errorf("expected ErrNotDone, got %v", err)
+	}
+
+	ss.Free()
+	_, err = ss.ListMech()
+	stateError(t, err, "ListMech", StateFreed)
+}
+
+// TestUninitializedState checks that zero values fail instead of panicking.
+func TestUninitializedState(t *testing.T) {
+	_, _, _, err := (&Client{}).Start([]string{"PLAIN"})
+	stateError(t, err, "Start", StateFreed)
+
+	_, err = (&Server{}).Decode([]byte("data"))
+	stateError(t, err, "Decode", StateFreed)
+}
@@ -0,0 +1,236 @@
+package sasl
+
+// #cgo LDFLAGS: -lsasl2
+// #cgo CFLAGS: -Wall
+// #include <sasl/sasl.h>
+// #include <sasl/saslplug.h>
+// #include <sasl/prop.h>
+// #include <stdlib.h>
+// #include <string.h>
+//
+// const struct propval *propval_at(const struct propval *vals, unsigned i);
+// const char *propval_value(const struct propval *val, unsigned i);
+//
+// extern int goAuxpropLookup(char *name, sasl_server_params_t *sparams,
+//       unsigned flags, char *user, unsigned ulen);
+// extern int goAuxpropStore(char *name, sasl_server_params_t *sparams,
+//       struct propctx *ctx, char *user, unsigned ulen);
+//
+// typedef struct UserStorePlug_struct {
+//     sasl_auxprop_plug_t usp_plug;
+//     char *usp_name;
+// } UserStorePlug;
+//
+// void userstore_free(void *glob_context, const sasl_utils_t *utils) {
+//     UserStorePlug *usp = (UserStorePlug *)glob_context;
+//     free(usp->usp_name);
+//     free(usp);
+// }
+//
+// int userstore_lookup(void *glob_context, sasl_server_params_t *sparams,
+//       unsigned flags, const char *user, unsigned ulen) {
+//     UserStorePlug *usp = (UserStorePlug *)glob_context;
+//     return goAuxpropLookup(usp->usp_name, sparams, flags, (char *)user,
+//           ulen);
+// }
+//
+// int userstore_store(void *glob_context, sasl_server_params_t *sparams,
+//       struct propctx *ctx, const char *user, unsigned ulen) {
+//     UserStorePlug *usp = (UserStorePlug *)glob_context;
+//     return goAuxpropStore(usp->usp_name, sparams, ctx, (char *)user,
+//           ulen);
+// }
+//
+// int userstore_init(const sasl_utils_t *utils, int max_version,
+//       int *out_version, sasl_auxprop_plug_t **plug, const char *plugname) {
+//     UserStorePlug *usp;
+//
+//     if( max_version < SASL_AUXPROP_PLUG_VERSION )
+//         return SASL_BADVERS;
+//
+//     usp = (UserStorePlug *)malloc(sizeof(UserStorePlug));
+//     if( !usp )
+//         return SASL_NOMEM;
+//     memset(usp, 0, sizeof(UserStorePlug));
+//     usp->usp_name = strdup(plugname);
+//     usp->usp_plug.glob_context   = usp;
+//     usp->usp_plug.auxprop_free   = userstore_free;
+//     usp->usp_plug.auxprop_lookup = userstore_lookup;
+//     usp->usp_plug.name           = usp->usp_name;
+//     usp->usp_plug.auxprop_store  = userstore_store;
+//
+//     *out_version = SASL_AUXPROP_PLUG_VERSION;
+//     *plug = &usp->usp_plug;
+//     return SASL_OK;
+// }
+//
+// int add_userstore(char *name) {
+//     return sasl_auxprop_add_plugin(name, userstore_init);
+// }
+import "C"
+import (
+	"context"
+	"errors"
+	"strings"
+	"unsafe"
+)
+
+// UserStore is a backend of users and their auxiliary properties, such as
+// "userPassword", that libsasl2 mechanisms read their secrets from. See
+// RegisterUserStore.
+//
+// ctx is the context passed to StartContext or StepContext of the Server
+// that needs the user, and context.Background() for Start, Step and the
+// password methods. A store should return once ctx is done, as an aborted
+// handshake keeps its connection until libsasl2 returns.
+type UserStore interface {
+	// Lookup returns the values of props for user in realm. Properties the
+	// user does not have are left out. It returns ErrNoUser if there is no
+	// such user.
+	Lookup(ctx context.Context, user, realm string, props []string) (
+		map[string][]string, error)
+
+	// Store sets props for user in realm, creating the user if needed. A
+	// property without values is removed.
+	Store(ctx context.Context, user, realm string,
+		props map[string][]string) error
+}
+
+// userStores holds the stores passed to RegisterUserStore.
+var userStores = newRegistry("user store", "RegisterUserStore", addUserStore)
+
+// RegisterUserStore registers store as the auxiliary property plugin name.
+// Servers use it when their "auxprop_plugin" option is name, and check
+// plaintext passwords against it when "pwcheck_method" is "auxprop".
+func RegisterUserStore(name string, store UserStore) error {
+	return userStores.register(name, store)
+}
+
+// addUserStore adds the plugin of a registered store to libsasl2.
+func addUserStore(name string, _ UserStore) C.int {
+	nameStr := C.CString(name)
+	defer C.free(unsafe.Pointer(nameStr))
+	return C.add_userstore(nameStr)
+}
+
+// splitUser splits user into a user name and a realm the way sasldb does.
+// The realm defaults to the user realm of the server or its host name.
+func splitUser(sparams *C.sasl_server_params_t, user string) (string,
+	string) {
+	if i := strings.LastIndexByte(user, '@'); i >= 0 {
+		return user[:i], user[i+1:]
+	}
+	if sparams.user_realm != nil {
+		return user, C.GoString(sparams.user_realm)
+	}
+	if sparams.serverFQDN != nil {
+		return user, C.GoString(sparams.serverFQDN)
+	}
+	return user, ""
+}
+
+// storeResult converts an error of a UserStore to a result code.
+func storeResult(err error) C.int {
+	var saslErr *Error
+	if errors.As(err, &saslErr) {
+		return C.int(saslErr.Code)
+	}
+	return C.SASL_FAIL
+}
+
+// auxpropLookup fills the properties requested in the context of sparams
+// from the store registered as name. Names starting with "*" belong to the
+// authentication identity, which libsasl2 looks up unless flags has
+// SASL_AUXPROP_AUTHZID.
+func auxpropLookup(name string, sparams *C.sasl_server_params_t,
+	flags C.uint, user string) C.int {
+	store, ok := userStores.get(name)
+	if !ok || sparams.propctx == nil {
+		return C.SASL_FAIL
+	}
+
+	authzID := flags&C.SASL_AUXPROP_AUTHZID != 0
+	override := flags&C.SASL_AUXPROP_OVERRIDE != 0
+
+	var wanted []string
+	fullNames := make(map[string]string)
+	vals := C.prop_get(sparams.propctx)
+	for i := C.uint(0); ; i++ {
+		val := C.propval_at(vals, i)
+		if val.name == nil {
+			break
+		}
+		fullName := C.GoString(val.name)
+		prop, isAuthn := strings.CutPrefix(fullName, "*")
+		if isAuthn == authzID {
+			continue
+		}
+		// another plugin found it already
+		if val.values != nil && !override {
+			continue
+		}
+		wanted = append(wanted, prop)
+		fullNames[prop] = fullName
+	}
+
+	user, realm := splitUser(sparams, user)
+	props, err := store.Lookup(connContext(sparams.utils.conn), user, realm,
+		wanted)
+	if err != nil {
+		return storeResult(err)
+	}
+
+	for prop, values := range props {
+		fullName, ok := fullNames[prop]
+		if !ok {
+			continue
+		}
+		fullNameStr := C.CString(fullName)
+		if override {
+			C.prop_erase(sparams.propctx, fullNameStr)
+		}
+		for _, value := range values {
+			valueStr := C.CString(value)
+			C.prop_set(sparams.propctx, fullNameStr, valueStr,
+				C.int(len(value)))
+			C.free(unsafe.Pointer(valueStr))
+		}
+		C.free(unsafe.Pointer(fullNameStr))
+	}
+	return C.SASL_OK
+}
+
+// auxpropStore saves the properties of ctx in the store registered as name.
+// A nil ctx only asks whether the plugin can store properties.
+func auxpropStore(name string, sparams *C.sasl_server_params_t,
+	ctx *C.struct_propctx, user string) C.int {
+	store, ok := userStores.get(name)
+	if !ok {
+		return C.SASL_FAIL
+	}
+	if ctx == nil {
+		return C.SASL_OK
+	}
+
+	props := make(map[string][]string)
+	vals := C.prop_get(ctx)
+	for i := C.uint(0); ; i++ {
+		val := C.propval_at(vals, i)
+		if val.name == nil {
+			break
+		}
+		prop := strings.TrimPrefix(C.GoString(val.name), "*")
+		values := []string{}
+		for j := C.uint(0); j < val.nvalues; j++ {
+			values = append(values, C.GoString(C.propval_value(val, j)))
+		}
+		props[prop] = values
+	}
+
+	user, realm := splitUser(sparams, user)
+	err := store.Store(connContext(sparams.utils.conn), user, realm, props)
+	if err != nil {
+		return storeResult(err)
+	}
+	return C.SASL_OK
+}
@@ -0,0 +1,114 @@
+package sasl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// passwordStore is a UserStore of plaintext passwords. An empty password
+// marks a disabled account. Looking up the user "slow" waits until ctx is
+// done, and then reports ctx.Err() on slowLookups.
+type passwordStore map[string]string
+
+// slowLookups receives the errors of the contexts of lookups of "slow".
+var slowLookups = make(chan error, 1)
+
+// Lookup implements UserStore.
+func (ps passwordStore) Lookup(ctx context.Context, user, realm string,
+	props []string) (map[string][]string, error) {
+	if user == "slow" {
+		<-ctx.Done()
+		slowLookups <- ctx.Err()
+		return nil, ErrUnavail
+	}
+	pass, ok := ps[user+"@"+realm]
+	if !ok {
+		return nil, ErrNoUser
+	}
+	if pass == "" {
+		return nil, ErrDisabled
+	}
+	found := make(map[string][]string)
+	for _, prop := range props {
+		if prop == "userPassword" {
+			found[prop] = []string{pass}
+		}
+	}
+	return found, nil
+}
+
+// Store implements UserStore.
+func (ps passwordStore) Store(ctx context.Context, user, realm string,
+	props map[string][]string) error {
+	return ErrNoChange
+}
+
+// TestRegisterUserStore checks passwords against a UserStore, also after the
+// library is initialized again.
+func TestRegisterUserStore(t *testing.T) {
+	RegisterTestMechanisms(t)
+	err := RegisterUserStore("gosasltest", passwordStore{})
+	if !errors.Is(err, ErrRegistered) {
+		t.Errorf("expected ErrRegistered, got %v", err)
+	}
+
+	for _, reinit := range []bool{false, true} {
+		if reinit {
+			if err := Shutdown(); err != nil {
+				t.Fatalf("could not shut down: %v", err)
+			}
+		}
+		ss := NewTestServer(t, &ServerConfig{
+			Options: map[string]string{
+				"auxprop_plugin": "gosasltest",
+				"pwcheck_method": "auxprop",
+			},
+		})
+		if err := ss.CheckPassword("alice", "secret"); err != nil {
+			t.Errorf("expected the password to match: %v", err)
+		}
+		if err := ss.CheckPassword("alice", "wrong"); !errors.Is(err,
+			ErrBadAuth) {
+			t.Errorf("expected ErrBadAuth, got %v", err)
+		}
+		if err := ss.CheckPassword("bob", "secret"); !errors.Is(err,
+			ErrBadAuth) {
+			t.Errorf("expected ErrBadAuth, got %v", err)
+		}
+		if exists, err := ss.UserExists("bob"); err != nil || exists {
+			t.Errorf("expected no bob, got %v, %v", exists, err)
+		}
+		err := ss.SetPassword("alice", "", "changed", 0)
+		if !errors.Is(err, ErrNoChange) {
+			t.Errorf("expected ErrNoChange, got %v", err)
+		}
+		ss.Free()
+	}
+}
+
+// TestUserStoreContext aborts a handshake while its UserStore looks up a
+// user, which sees the context of the handshake.
+func TestUserStoreContext(t *testing.T) {
+	ss := NewMechServer(t, nil)
+	defer ss.Free()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		50*time.Millisecond)
+	defer cancel()
+	_, _, err := ss.StartContext(ctx, "PLAIN", []byte("\x00slow\x00secret"))
+	if !errors.Is(err, ErrAborted) ||
+		!errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected an aborted handshake, got %v", err)
+	}
+
+	select {
+	case err := <-slowLookups:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the lookup to see the deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the lookup did not see the end of the handshake")
+	}
+}